@@ -1,16 +1,17 @@
 package build
 
 import (
-	"archive/tar"
-	"bytes"
 	"fmt"
 	"github.com/containers/buildah"
 	"github.com/containers/buildah/define"
 	"github.com/containers/storage"
 	rspec "github.com/opencontainers/runtime-spec/specs-go"
-	"github.com/redhat-buildpacks/poc/buildah/util"
+	"github.com/openshift/imagebuilder"
+	"github.com/redhat-buildpacks/poc/extender/config"
+	"github.com/redhat-buildpacks/poc/extender/logging"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/extender/util"
 	"github.com/sirupsen/logrus"
-	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -21,46 +22,29 @@ type BuildahParameters struct {
 	StoreOptions      storage.StoreOptions
 	TempDir           string
 	WorkspaceDir      string
+	CacheDir          string
 	StorageRootDir    string
 	StorageRunRootDir string
 	GraphDriverName   string
-	ExtractLayers     bool
-	RootFSDir         string
+	PolicyPath        string                   // Path to a signature verification policy file
+	InsecurePolicy    bool                     // Use an "allow everything" signature verification policy
+	Output            *logging.RedactingWriter // Output of the build, whose secrets are redacted as for the logs
 }
 
-func InitOptions() *BuildahParameters {
+func InitOptions(c *config.Config) *BuildahParameters {
 	b := &BuildahParameters{}
+	b.WorkspaceDir = c.WorkspaceDir
+	b.CacheDir = c.CacheDir
 
-	b.WorkspaceDir = os.Getenv("WORKSPACE_DIR")
-	if b.WorkspaceDir == "" {
-		b.WorkspaceDir = "/workspace/buildah-layers"
-	}
-	logrus.Infof("WORKSPACE DIR: %s", b.WorkspaceDir)
-
-	b.GraphDriverName = os.Getenv("GRAPH_DRIVER")
-	if b.GraphDriverName == "" {
-		b.GraphDriverName = "vfs"
-	}
+	b.GraphDriverName = c.GraphDriver
 	logrus.Infof("GRAPH_DRIVER: %s", b.GraphDriverName)
 
-	b.StorageRootDir = os.Getenv("STORAGE_ROOT_PATH")
-	if b.StorageRootDir == "" {
-		b.StorageRootDir = "/var/lib/containers/storage"
-	}
+	b.StorageRootDir = c.StorageRootDir
 	logrus.Infof("STORAGE ROOT PATH: %s", b.StorageRootDir)
 
-	b.StorageRunRootDir = os.Getenv("STORAGE_RUN_ROOT_PATH")
-	if b.StorageRunRootDir == "" {
-		b.StorageRunRootDir = "/var/run/containers/storage"
-	}
+	b.StorageRunRootDir = c.StorageRunRootDir
 	logrus.Infof("STORAGE RUN ROOT PATH: %s", b.StorageRunRootDir)
 
-	b.RootFSDir = os.Getenv("ROOT_FS_DIR")
-	if b.RootFSDir == "" {
-		b.RootFSDir = "/"
-	}
-	logrus.Infof("ROOT FS DIR (where files should be extracted): %s", b.RootFSDir)
-
 	var transientMounts []string
 
 	// Buildah context should be the same as the dir where Dockerfiles, files to be copied are located
@@ -70,7 +54,8 @@ func InitOptions() *BuildahParameters {
 	dateStamp := fmt.Sprintf("%d", time.Now().UnixNano())
 	buildahImage := fmt.Sprintf("buildpack-buildah:%s-%d", dateStamp, 1)
 
-	output := io.MultiWriter(os.Stderr, &bytes.Buffer{})
+	// The output of the RUN instructions does not go through the logs: the secrets are redacted by the writer
+	b.Output = logging.NewRedactingWriter(os.Stderr)
 
 	// Define image build options
 	b.BuildOptions = define.BuildOptions{
@@ -83,8 +68,8 @@ func InitOptions() *BuildahParameters {
 		TransientMounts:         transientMounts,
 		Output:                  buildahImage,
 		OutputFormat:            buildah.Dockerv2ImageManifest,
-		Out:                     output,
-		Err:                     output,
+		Out:                     b.Output,
+		Err:                     b.Output,
 		Layers:                  false, // TODO: Check with containers team what the value should be and this option do
 		NoCache:                 true,
 		RemoveIntermediateCtrs:  true,
@@ -103,76 +88,60 @@ func InitOptions() *BuildahParameters {
 	return b
 }
 
-func (b *BuildahParameters) ExtractTGZFile(path string) {
-	logrus.Infof("Tgz file to be extracted %s",path)
-	err := b.untarFile(path, b.RootFSDir)
-	if err != nil {
-		panic(err)
+// SetBuildContext sets the build context dir of the next Dockerfile to be built. The files excluded by the ignore file of
+// the Dockerfile or of the context dir are not part of the context
+func (b *BuildahParameters) SetBuildContext(pathToDockerFile string, contextDir string) error {
+	if _, err := os.Stat(contextDir); err != nil {
+		return fmt.Errorf("build context of the Dockerfile %s: %w", pathToDockerFile, err)
+	}
+	b.BuildOptions.ContextDirectory = contextDir
+	logrus.Infof("Build context: %s", contextDir)
+
+	// Buildah only reads the ignore file of the context dir: the patterns of the ignore file of the Dockerfile are passed
+	// as excludes, which replace it
+	b.BuildOptions.Excludes = nil
+	if ignoreFile := util.IgnoreFile(pathToDockerFile, contextDir); ignoreFile != "" {
+		excludes, err := imagebuilder.ParseIgnore(ignoreFile)
+		if err != nil {
+			return fmt.Errorf("ignore file of the Dockerfile %s: %w", pathToDockerFile, err)
+		}
+		b.BuildOptions.Excludes = excludes
+		logrus.Infof("Files excluded from the build context listed in %s", ignoreFile)
 	}
+	return nil
 }
 
-func (b *BuildahParameters) untarFile(tgzFilePath string, targetDir string) (err error) {
-
-	// create a Reader of the gzip file
-	gzf, err := util.UnGzip(tgzFilePath)
+// MountSecrets passes the secrets of the next Dockerfile to be built to Buildah, which mounts them for its RUN
+// instructions using RUN --mount=type=secret,id=<id>. Their values are copied to a private temp dir as Buildah reads
+// the secrets from files. The returned func removes the temp dir, which is removed as well when a secret cannot be mounted
+func (b *BuildahParameters) MountSecrets(secrets []model.Secret) (func(), error) {
+	b.BuildOptions.CommonBuildOpts.Secrets = nil
+	if len(secrets) == 0 {
+		return func() {}, nil
+	}
+	dir, err := os.MkdirTemp(b.TempDir, "secrets")
 	if err != nil {
-		logrus.Panicf("Something wrong happened ... %s", err)
+		return nil, fmt.Errorf("secrets dir cannot be created: %w", err)
 	}
-
-	// Open the tar file from the tgz reader
-	tr := tar.NewReader(gzf)
-	// Get each tar segment
-	for true {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
+	unmount := func() {
+		b.BuildOptions.CommonBuildOpts.Secrets = nil
+		if err := os.RemoveAll(dir); err != nil {
+			logrus.Warnf("Secrets dir %s not removed: %s", dir, err)
 		}
+	}
+	for _, secret := range secrets {
+		value, err := util.ReadSecret(secret, b.WorkspaceDir)
 		if err != nil {
-			logrus.Fatalf("ExtractTarGz: Next() failed: %v", err)
+			unmount()
+			return nil, err
 		}
-
-		// the target location where the dir/file should be created
-		target := filepath.Join(targetDir, hdr.Name)
-		logrus.Debugf("File to be extracted: %s", target)
-
-		if b.ExtractLayers {
-			switch hdr.Typeflag {
-			case tar.TypeDir:
-				if _, err := os.Stat(target); err != nil {
-					// TODO: Should we define a const for the permission
-					if err := os.Mkdir(target, 0755); err != nil {
-						logrus.Fatalf("ExtractTarGz: Mkdir() failed: %s", err.Error())
-						return err
-					}
-				}
-			case tar.TypeReg:
-				pathExists := util.FileExists(target)
-				if pathExists {
-					logrus.Debugf("ExtractTarGz: %s exists: %t\n", target, pathExists)
-				} else {
-					outFile, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(hdr.Mode))
-					if err != nil {
-						logrus.Fatalf("ExtractTarGz: Create() failed: %s", err.Error())
-						return err
-					}
-					if _, err := io.Copy(outFile, tr); err != nil {
-						logrus.Fatalf("ExtractTarGz: Copy() failed: %s", err.Error())
-						return err
-					}
-					// manually close here after each file operation; defering would cause each file close
-					// to wait until all operations have completed.
-					logrus.Debugf("File extracted to %s", outFile.Name())
-					outFile.Close()
-				}
-
-			default:
-				logrus.Debugf(
-					"ExtractTarGz: unknown type: %c in %s",
-					hdr.Typeflag,
-					hdr.Name)
-			}
+		path := filepath.Join(dir, secret.ID)
+		if err := os.WriteFile(path, value, 0400); err != nil {
+			unmount()
+			return nil, fmt.Errorf("secret %s cannot be written: %w", secret.ID, err)
 		}
-
+		b.BuildOptions.CommonBuildOpts.Secrets = append(b.BuildOptions.CommonBuildOpts.Secrets, "id="+secret.ID+",src="+path)
+		logrus.Infof("Secret %s mounted at %s", secret.ID, filepath.Join(model.SecretsDir, secret.ID))
 	}
-	return nil
+	return unmount, nil
 }
@@ -0,0 +1,60 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/redhat-buildpacks/poc/extender/config"
+)
+
+func TestInitOptions(t *testing.T) {
+	b := InitOptions(&config.Config{WorkspaceDir: t.TempDir()})
+	// The output of the RUN instructions is redacted as the logs
+	if b.Output == nil || b.BuildOptions.Out != b.Output || b.BuildOptions.Err != b.Output {
+		t.Errorf("the output of the build is not redacted: %+v", b.BuildOptions)
+	}
+}
+
+func TestSetBuildContext(t *testing.T) {
+	contextDir := t.TempDir()
+	dockerfile := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(filepath.Join(contextDir, ".dockerignore"), []byte("context.txt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &BuildahParameters{}
+	if err := b.SetBuildContext(dockerfile, contextDir); err != nil {
+		t.Fatal(err)
+	}
+	if b.BuildOptions.ContextDirectory != contextDir || !reflect.DeepEqual(b.BuildOptions.Excludes, []string{"context.txt"}) {
+		t.Errorf("unexpected context dir %s or excludes %v", b.BuildOptions.ContextDirectory, b.BuildOptions.Excludes)
+	}
+
+	// The ignore file of the Dockerfile has the precedence over the one of the context dir
+	if err := os.WriteFile(dockerfile+".dockerignore", []byte("# Comment\n/secret.txt\n*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetBuildContext(dockerfile, contextDir); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"secret.txt", "*.log"}; !reflect.DeepEqual(b.BuildOptions.Excludes, want) {
+		t.Errorf("excludes: got %v, want %v", b.BuildOptions.Excludes, want)
+	}
+
+	// The excludes of the previous Dockerfile are not kept
+	if err := os.Remove(filepath.Join(contextDir, ".dockerignore")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetBuildContext(filepath.Join(contextDir, "Dockerfile"), contextDir); err != nil {
+		t.Fatal(err)
+	}
+	if b.BuildOptions.Excludes != nil {
+		t.Errorf("unexpected excludes %v", b.BuildOptions.Excludes)
+	}
+
+	if err := b.SetBuildContext(dockerfile, filepath.Join(contextDir, "missing")); err == nil {
+		t.Error("expected an error for a missing context dir")
+	}
+}
@@ -0,0 +1,34 @@
+package build
+
+import (
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"testing"
+)
+
+func TestLintSampleDockerfiles(t *testing.T) {
+	tests := []struct {
+		dockerfile string
+		lines      []int
+	}{
+		{dockerfile: "curl", lines: nil},
+		{dockerfile: "rebasable", lines: nil},
+		{dockerfile: "ozzy", lines: []int{1, 4}}, // FROM redhat/ubi8-minimal:latest, USER root
+	}
+	for _, test := range tests {
+		path := "../../../workspace/layers/" + test.dockerfile + "/Dockerfile"
+		instructions, err := ParseDockerfile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		problems := model.LintDockerfile(path, instructions)
+		if len(problems) != len(test.lines) {
+			t.Errorf("%s: expected %d problem(s), got: %v", test.dockerfile, len(test.lines), problems)
+			continue
+		}
+		for i, p := range problems {
+			if p.Line != test.lines[i] {
+				t.Errorf("%s: %s, expected line %d", test.dockerfile, p, test.lines[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/buildah/imagebuildah"
+	istorage "github.com/containers/image/v5/storage"
+	"github.com/containers/storage"
+	"github.com/redhat-buildpacks/poc/extender/config"
+	"github.com/redhat-buildpacks/poc/extender/engine"
+	"github.com/redhat-buildpacks/poc/extender/extract"
+	"github.com/redhat-buildpacks/poc/extender/failure"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/sirupsen/logrus"
+)
+
+// EngineName is the name of the buildah engine, e.g. ENGINE=buildah
+const EngineName = "buildah"
+
+// New creates the buildah engine building the Dockerfiles of the workspace dir of the config
+func New(c *config.Config) (engine.Engine, error) {
+	b := InitOptions(c)
+	os.Setenv("BUILDAH_TEMP_DIR", b.TempDir)
+	logrus.Infof("Buildah tempdir: %s", b.TempDir)
+	return b, nil
+}
+
+// Name returns the name of the engine
+func (b *BuildahParameters) Name() string {
+	return EngineName
+}
+
+// ParseDockerfile parses the instructions of a Dockerfile using the parser of buildah
+func (b *BuildahParameters) ParseDockerfile(path string) ([]model.Instruction, error) {
+	return ParseDockerfile(path)
+}
+
+// Build builds the Dockerfile within the local storage and copies the image as an OCI layout, under the cache dir when
+// the request has no layout dir, in order to read its new layers. The reference of the image is its ID. The errors are
+// categorized by the step which failed: build, pull of the base image or export of the new layers
+func (b *BuildahParameters) Build(req engine.Request) (engine.Image, error) {
+	ctx := context.TODO()
+
+	if err := b.SetBuildContext(req.Dockerfile, req.ContextDir); err != nil {
+		return engine.Image{}, failure.Wrap(failure.Metadata, err)
+	}
+	unmountSecrets, err := b.MountSecrets(req.Secrets)
+	if err != nil {
+		return engine.Image{}, failure.Wrap(failure.Build, err)
+	}
+	defer unmountSecrets()
+	b.BuildOptions.Args = model.ArgMap(req.Args)
+
+	// GetStore attempts to find an already-created Store object matching the
+	// specified location and graph driver, and if it can't, it creates and
+	// initializes a new Store object, and the underlying storage that it controls.
+	store, err := storage.GetStore(b.StoreOptions)
+	if err != nil {
+		return engine.Image{}, failure.Wrapf(failure.Config, err, "storage %s", b.StoreOptions.GraphRoot)
+	}
+
+	/* Parse the content of the Dockerfile to execute the different commands: FROM, RUN, ...
+	   Return the:
+	   - imageID: id of the new image created. String of 64 chars.
+	     NOTE: The first 12 chars corresponds to the `id` displayed using `sudo buildah --storage-driver vfs images`
+	   - digest: image repository name prefixed "localhost/". e.g: localhost/buildpack-buildah:TAG@sha256:64_CHAR_SHA
+	*/
+	imageID, digest, err := imagebuildah.BuildDockerfiles(ctx, store, b.BuildOptions, req.Dockerfile)
+	if err := b.Output.Flush(); err != nil {
+		logrus.Warnf("Output of the build not written: %s", err)
+	}
+	if err != nil {
+		return engine.Image{}, failure.Wrap(failure.Build, err)
+	}
+	logrus.Infof("Image id: %s", imageID)
+	logrus.Infof("Image digest: %s", digest.String())
+
+	ref, err := istorage.Transport.NewStoreReference(store, nil, imageID)
+	if err != nil {
+		return engine.Image{}, failure.Wrap(failure.Export, err)
+	}
+	logrus.Infof("Image repository id: %s", imageID[0:11])
+	logrus.Info("Image built successfully :-)")
+
+	// Copy the layers from the local storage to an OCI layout
+	layoutDir := req.Layout
+	if layoutDir == "" {
+		layoutDir = filepath.Join(b.CacheDir, imageID[0:11])
+	} else if err := os.RemoveAll(layoutDir); err != nil {
+		return engine.Image{}, failure.Wrap(failure.Export, err)
+	}
+	ociImageReference, err := b.CopyImageTo(ref, "oci:"+layoutDir+":latest")
+	if err != nil {
+		return engine.Image{}, failure.Wrapf(failure.Export, err, "OCI layout %s", layoutDir)
+	}
+
+	// Get the paths of the new layer files created under the OCI layout
+	baseDiffIDs, err := b.BaseImageDiffIDs(ctx, store, req.Dockerfile)
+	if err != nil {
+		return engine.Image{}, failure.Wrapf(failure.Pull, err, "base image of the Dockerfile %s", req.Dockerfile)
+	}
+	// The manifest is only logged for debugging purpose
+	if logrus.IsLevelEnabled(logrus.DebugLevel) {
+		if err := ShowRawManifestContent(ociImageReference); err != nil {
+			logrus.Warnf("Manifest of the image %s not logged: %s", layoutDir, err)
+		}
+	}
+	manifestDigest, extended, err := GetNewLayers(ociImageReference, baseDiffIDs)
+	if err != nil {
+		return engine.Image{}, failure.Wrap(failure.Export, err)
+	}
+
+	paths, err := GetPathNewLayerTarGZipFiles(layoutDir, extended)
+	if err != nil {
+		return engine.Image{}, failure.Wrap(failure.Export, err)
+	}
+	img := engine.Image{Reference: imageID, Digest: manifestDigest}
+	for i, path := range paths {
+		img.Layers = append(img.Layers, extract.Layer{ExtendedLayer: extended[i], Open: extract.OpenFile(path)})
+	}
+	return img, nil
+}
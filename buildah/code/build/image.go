@@ -0,0 +1,271 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	istorage "github.com/containers/image/v5/storage"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/openshift/imagebuilder"
+	"github.com/redhat-buildpacks/poc/buildah/parse"
+	"github.com/redhat-buildpacks/poc/extender/extract"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/layer"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+)
+
+// getPolicyContext returns a *signature.PolicyContext based on the policy options.
+func (b *BuildahParameters) getPolicyContext() (*signature.PolicyContext, error) {
+	var policy *signature.Policy // This could be cached across calls in b.
+	var err error
+	if b.InsecurePolicy {
+		policy = &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
+	} else if b.PolicyPath == "" {
+		policy, err = signature.DefaultPolicy(nil)
+	} else {
+		policy, err = signature.NewPolicyFromFile(b.PolicyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return signature.NewPolicyContext(policy)
+}
+
+func ShowRawManifestContent(ref types.ImageReference) error {
+	// Create a FromSource object to read the image content
+	src, err := ref.NewImage(context.TODO(), nil)
+	if err != nil {
+		return fmt.Errorf("error getting the image: %w", err)
+	}
+	defer src.Close()
+
+	// Get the Image Manifest and log it as JSON indented string
+	// See spec: https://docs.docker.com/registry/spec/manifest-v2-2/#image-manifest
+	rawManifest, _, err := src.Manifest(context.TODO())
+	if err != nil {
+		return fmt.Errorf("error while getting the raw manifest: %w", err)
+	}
+	return parse.JsonIndent("Image manifest", rawManifest)
+}
+
+func ShowOCIContent(ref types.ImageReference) error {
+	// Create a FromSource object to read the image content
+	src, err := ref.NewImage(context.TODO(), nil)
+	if err != nil {
+		return fmt.Errorf("error getting the image: %w", err)
+	}
+	defer src.Close()
+	// Get the OCIConfig configuration as per OCI v1 image-spec.
+	// Log it as JSON indented string
+	config, err := src.OCIConfig(context.TODO())
+	if err != nil {
+		return fmt.Errorf("error parsing OCI Config: %w", err)
+	}
+	return parse.JsonMarshal("OCI Config", config)
+}
+
+// CopyImage copies the image from the local storage to an OCI layout of the cache dir named after the image ID
+func (b *BuildahParameters) CopyImage(srcRef types.ImageReference, imageID string) (types.ImageReference, error) {
+	return b.CopyImageTo(srcRef, "oci:"+filepath.Join(b.CacheDir, imageID[0:11])+":latest")
+}
+
+// CopyImageTo copies the image from the local storage to the destination, e.g. oci:<path>:<tag>
+func (b *BuildahParameters) CopyImageTo(srcRef types.ImageReference, destURL string) (types.ImageReference, error) {
+
+	policyContext, err := b.getPolicyContext()
+	if err != nil {
+		return nil, err
+	}
+	defer policyContext.Destroy()
+
+	destRef, err := alltransports.ParseImageName(destURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// copy image
+	_, err = copy.Image(context.TODO(), policyContext, destRef, srcRef, &copy.Options{
+		RemoveSignatures:      false,
+		SignBy:                "",
+		ReportWriter:          nil,
+		SourceCtx:             nil,
+		DestinationCtx:        nil,
+		ForceManifestMIMEType: parseManifestFormat("oci"),
+		ImageListSelection:    copy.CopySystemImage,
+		OciDecryptConfig:      nil,
+		OciEncryptLayers:      nil,
+		OciEncryptConfig:      nil,
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		logrus.Infof("Image copied to %s", destURL)
+	}
+	return destRef, nil
+}
+
+// BaseImageDiffIDs returns the diffIDs of the layers of the base image used by the last stage of the Dockerfile.
+// The base image has been pulled within the local storage during the build
+func (b *BuildahParameters) BaseImageDiffIDs(ctx context.Context, store storage.Store, pathToDockerFile string) ([]string, error) {
+	node, err := imagebuilder.ParseFile(pathToDockerFile)
+	if err != nil {
+		return nil, err
+	}
+	stages, err := imagebuilder.NewStages(node, imagebuilder.NewBuilder(b.BuildOptions.Args))
+	if err != nil {
+		return nil, err
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no stage found in %s", pathToDockerFile)
+	}
+
+	// The image built is the one of the last stage. A stage built from a previous one shares its base image
+	stage := stages[len(stages)-1]
+	baseName, err := stage.Builder.From(stage.Node)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		previous, ok := stages.ByName(baseName)
+		if !ok || previous.Position >= stage.Position {
+			break
+		}
+		stage = previous
+		if baseName, err = stage.Builder.From(stage.Node); err != nil {
+			return nil, err
+		}
+	}
+	logrus.Infof("Base image: %s", baseName)
+	if baseName == "scratch" {
+		return nil, nil
+	}
+
+	// In chained mode, the base image is the ID of the image produced by the previous extension
+	var ref types.ImageReference
+	if img, err := store.Image(baseName); err == nil && img.ID == baseName {
+		ref, err = istorage.Transport.NewStoreReference(store, nil, img.ID)
+		if err != nil {
+			return nil, err
+		}
+	} else if ref, err = istorage.Transport.ParseStoreReference(store, baseName); err != nil {
+		return nil, err
+	}
+	img, err := ref.NewImage(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffIDs []string
+	for _, diffID := range config.RootFS.DiffIDs {
+		logrus.Infof("Layer diffID of base image is: %s", diffID)
+		diffIDs = append(diffIDs, diffID.String())
+	}
+	return diffIDs, nil
+}
+
+// GetPathNewLayerTarGZipFiles returns, in order, the paths of the new layer files of the image copied as an OCI layout
+// under layoutDir. An error is returned when the digest of a layer is invalid
+func GetPathNewLayerTarGZipFiles(layoutDir string, layers []model.ExtendedLayer) ([]string, error) {
+	var paths []string
+	for _, l := range layers {
+		pathTarGZipLayer, err := extract.BlobPath(layoutDir, l.Digest)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Infof("Path to the new TarGzipLayer file: %s", pathTarGZipLayer)
+		paths = append(paths, pathTarGZipLayer)
+	}
+	return paths, nil
+}
+
+// GetNewLayers returns the digest of the image and, in order, its layers which do not belong to the base image
+func GetNewLayers(destRef types.ImageReference, baseDiffIDs []string) (string, []model.ExtendedLayer, error) {
+	src, err := destRef.NewImageSource(context.TODO(), nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("image source cannot be created: %w", err)
+	}
+
+	defer func() {
+		if err := src.Close(); err != nil {
+			logrus.Warnf("Could not close image: %s", err)
+		}
+	}()
+
+	rawManifest, _, err := src.GetManifest(context.TODO(), nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("error while getting the raw manifest: %w", err)
+	}
+	digest, err := manifest.Digest(rawManifest)
+	if err != nil {
+		return "", nil, fmt.Errorf("error computing the digest of the manifest: %w", err)
+	}
+
+	img, err := image.FromUnparsedImage(context.TODO(), nil, image.UnparsedInstance(src, nil))
+	if err != nil {
+		return "", nil, fmt.Errorf("error parsing manifest for image: %w", err)
+	}
+	config, err := img.OCIConfig(context.TODO())
+	if err != nil {
+		return "", nil, fmt.Errorf("error parsing OCI Config: %w", err)
+	}
+
+	// Get the layers from the source and log the Layer SHA
+	blobs := img.LayerInfos()
+	for _, blobInfo := range blobs {
+		logrus.Infof("Layer blobInfo: %s\n", blobInfo.Digest.String())
+	}
+	if len(blobs) != len(config.RootFS.DiffIDs) {
+		return "", nil, fmt.Errorf("the image has %d layers but %d diffIDs", len(blobs), len(config.RootFS.DiffIDs))
+	}
+
+	var diffIDs []string
+	for _, diffID := range config.RootFS.DiffIDs {
+		diffIDs = append(diffIDs, diffID.String())
+	}
+
+	// The layers which are not part of the base image correspond to our new image
+	indexes, err := layer.NewLayers(diffIDs, baseDiffIDs)
+	if err != nil {
+		return "", nil, err
+	}
+	var layers []model.ExtendedLayer
+	for _, i := range indexes {
+		layers = append(layers, model.ExtendedLayer{
+			Digest:    blobs[i].Digest.String(),
+			DiffID:    diffIDs[i],
+			MediaType: blobs[i].MediaType,
+			Size:      blobs[i].Size,
+		})
+	}
+	logrus.Infof("%d new layer(s) out of %d", len(layers), len(blobs))
+	return digest.String(), layers, nil
+}
+
+// parseManifestFormat parses format parameter for copy and sync command.
+// It returns string value to use as manifest MIME type
+func parseManifestFormat(manifestFormat string) string {
+	switch manifestFormat {
+	case "oci":
+		return imgspecv1.MediaTypeImageManifest
+	case "v2s1":
+		return manifest.DockerV2Schema1SignedMediaType
+	case "v2s2":
+		return manifest.DockerV2Schema2MediaType
+	default:
+		logrus.Errorf("unknown format %q. Choose one of the supported formats: 'oci', 'v2s1', or 'v2s2'", manifestFormat)
+		return ""
+	}
+}
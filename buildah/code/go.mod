@@ -3,15 +3,25 @@ module github.com/redhat-buildpacks/poc/buildah
 go 1.16
 
 require (
-    github.com/BurntSushi/toml v1.0.0
+	github.com/BurntSushi/toml v1.0.0
 	github.com/containers/buildah v1.23.1
 	github.com/containers/common v0.44.3 // indirect
 	github.com/containers/image/v5 v5.16.1
 	github.com/containers/storage v1.37.0
 	github.com/opencontainers/image-spec v1.0.2-0.20210819154149-5ad6f50d6283
 	github.com/opencontainers/runtime-spec v1.0.3-0.20210326190908-1c3f411f0417
-	github.com/pkg/errors v0.9.1
+	github.com/openshift/imagebuilder v1.2.2-0.20210415181909-87f3e48c2656
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/redhat-buildpacks/poc/extender v0.0.0
+	github.com/redhat-buildpacks/poc/layer v0.0.0
 	github.com/sirupsen/logrus v1.8.1
+	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e
+)
+
+// The packages and the layer applier shared by the engines
+replace (
+	github.com/redhat-buildpacks/poc/extender => ../../extender
+	github.com/redhat-buildpacks/poc/layer => ../../layer
 )
 
 // replace github.com/containers/storage v1.37.0 => /Users/cmoullia/code/containers/storage
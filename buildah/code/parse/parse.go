@@ -3,25 +3,24 @@ package parse
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/sirupsen/logrus"
 )
 
-func JsonIndent(desc string, in []byte) {
+func JsonIndent(desc string, in []byte) error {
 	var buf bytes.Buffer
-	err := json.Indent(&buf, in, "", "    ")
-	if err == nil {
-		logrus.Infof("%s: %s\n", desc, &buf)
-	} else {
-		logrus.Fatalf("Cannot indent the JSON raw content ! %s",err)
+	if err := json.Indent(&buf, in, "", "    "); err != nil {
+		return fmt.Errorf("cannot indent the JSON raw content of the %s: %w", desc, err)
 	}
+	logrus.Debugf("%s: %s\n", desc, &buf)
+	return nil
 }
 
-func JsonMarshal(desc string, c interface{}) {
+func JsonMarshal(desc string, c interface{}) error {
 	out, err := json.MarshalIndent(c, "", "    ")
-	if err == nil {
-		logrus.Infof("%s: %s\n", desc, string(out))
-	} else {
-		logrus.Fatal("Cannot marshal !",err)
+	if err != nil {
+		return fmt.Errorf("cannot marshal the %s: %w", desc, err)
 	}
+	logrus.Infof("%s: %s\n", desc, string(out))
+	return nil
 }
-
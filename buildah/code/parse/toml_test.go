@@ -3,7 +3,7 @@ package parse_test
 import (
 	"fmt"
 	"github.com/BurntSushi/toml"
-	"github.com/redhat-buildpacks/poc/buildah/model"
+	"github.com/redhat-buildpacks/poc/extender/model"
 	"reflect"
 	"testing"
 )
@@ -49,28 +49,46 @@ build = true
 run = true
 `
 
-	expected := model.Metadata{[]model.Dockerfile{
-		{Path: "/layers/samples_curl/Dockerfile",
-			Build:       true,
-			Run:         true,
-			ExtensionID: "samples/curl",
-			Args: model.DockerfileArg{
-				BuildArg: []model.BuildArg{
-					{Key: "some_arg", Value: "some-arg-build-value"},
-					{Key: "base_image", Value: "ubuntu"},
-				},
-				RunArg: []model.RunArg{
-					{Key: "some_arg", Value: "some-arg-launch-value"},
-				},
+	expected := model.Metadata{
+		Buildpacks: []model.Buildpack{
+			{
+				API:       "0.7",
+				ID:        "samples/curl",
+				Version:   "0.0.1",
+				Homepage:  "https://github.com/buildpacks/samples/tree/main/extensions/curl",
+				Extension: true,
+			},
+			{
+				API:       "0.7",
+				ID:        "samples/rebasable",
+				Version:   "0.0.1",
+				Homepage:  "https://github.com/buildpacks/samples/tree/main/extensions/rebasable",
+				Extension: true,
 			},
 		},
-		{
-			Path:        "/cnb/ext/samples_rebasable/0.0.1/Dockerfile",
-			Build:       true,
-			Run:         true,
-			ExtensionID: "samples/rebasable",
+		Dockerfiles: []model.Dockerfile{
+			{Path: "/layers/samples_curl/Dockerfile",
+				Build:       boolPtr(true),
+				Run:         boolPtr(true),
+				ExtensionID: "samples/curl",
+				Args: model.DockerfileArg{
+					BuildArg: []model.BuildArg{
+						{Key: "some_arg", Value: "some-arg-build-value"},
+						{Key: "base_image", Value: "ubuntu"},
+					},
+					RunArg: []model.RunArg{
+						{Key: "some_arg", Value: "some-arg-launch-value"},
+					},
+				},
+			},
+			{
+				Path:        "/cnb/ext/samples_rebasable/0.0.1/Dockerfile",
+				Build:       boolPtr(true),
+				Run:         boolPtr(true),
+				ExtensionID: "samples/rebasable",
+			},
 		},
-	}}
+	}
 
 	var got model.Metadata
 	if _, err := toml.Decode(tomlMetadata, &got); err != nil {
@@ -81,6 +99,26 @@ run = true
 	}
 }
 
+func TestDecodeExtensionDescriptor(t *testing.T) {
+	var got model.ExtensionDescriptor
+	if _, err := toml.DecodeFile("../../../workspace/layers/rebasable/extension.toml", &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := model.ExtensionDescriptor{
+		API: "0.7",
+		Extension: model.ExtensionInfo{
+			ID:          "samples/rebasable",
+			Name:        "Rebasable Extension",
+			Version:     "0.0.1",
+			Homepage:    "https://github.com/buildpacks/samples/tree/main/extensions/rebasable",
+			Description: "This extension is rebasable because it creates a single directory under /opt.",
+		},
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("\n%#v\n!=\n%#v\n", expected, got)
+	}
+}
+
 func TestConvertStructToMapOfString(t *testing.T) {
 	args := []model.BuildArg{
 		{Key: "some_arg", Value: "some-arg-build-value"},
@@ -93,3 +131,7 @@ func TestConvertStructToMapOfString(t *testing.T) {
 	}
 	fmt.Println(x)
 }
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,334 @@
+// Package app extends the images using the registered engine selected by the ENGINE setting: it loads the metadata,
+// resolves the args of the Dockerfiles, builds them phase by phase, applies the new layers to the root FS dir and
+// reports what has been built
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/redhat-buildpacks/poc/extender/config"
+	"github.com/redhat-buildpacks/poc/extender/engine"
+	"github.com/redhat-buildpacks/poc/extender/extract"
+	"github.com/redhat-buildpacks/poc/extender/failure"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/extender/util"
+	"github.com/redhat-buildpacks/poc/layer"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	baseImageArg              = "base_image"
+	runImageLayoutName        = "image"
+	runImageExtensionFileName = "extended-layers.json"
+	fromDebuggerArg           = "from-debugger"
+)
+
+// App extends the images using an engine
+type App struct {
+	Config     *config.Config
+	Engine     engine.Engine
+	ArgSources model.ArgSources // Build args passed to all the Dockerfiles: env vars, args file and --build-arg flags
+	Extractor  *extract.Extractor
+}
+
+// Main executes the command of the command line, by default the build of the Dockerfiles with the engine selected by
+// the ENGINE env var or the --engine flag
+func Main() {
+	cmdArgs := os.Args[1:]
+	if len(cmdArgs) > 0 && cmdArgs[0] == fromDebuggerArg {
+		cmdArgs = cmdArgs[1:]
+	} else if _, ok := os.LookupEnv("DEBUG"); ok {
+		execDebugger(cmdArgs)
+	}
+	if err := Execute(filepath.Base(os.Args[0]), cmdArgs); err != nil {
+		// The error is returned up the stack so that the deferred cleanups run before exiting with the code of its category
+		logrus.Error(failure.Summary(err))
+		os.Exit(failure.ExitCode(err))
+	}
+}
+
+// New creates the app building the Dockerfiles with the engine, which is nil for the commands which do not build nor
+// parse them. The env args and the args file are loaded according to the config
+func New(c *config.Config, e engine.Engine) (*App, error) {
+	a := &App{
+		Config: c,
+		Engine: e,
+		Extractor: &extract.Extractor{
+			RootFSDir:          c.RootFSDir,
+			Extract:            c.ExtractLayers,
+			DryRun:             c.DryRun,
+			PreserveAttributes: c.PreserveAttributes,
+			OverwritePolicy:    c.OverwritePolicy,
+			BackupDir:          c.BackupDir,
+			PlanFile:           c.PlanFile,
+			JournalFile:        c.JournalFile,
+			JournalBackupDir:   c.JournalBackupDir,
+		},
+	}
+	if c.RemapIDs {
+		idMappings, err := layer.LoadIDMappings(layer.SubUIDFile, layer.SubGIDFile)
+		if err != nil {
+			return nil, failure.Wrapf(failure.Config, err, "ID mappings cannot be loaded")
+		}
+		a.Extractor.IDMappings = idMappings
+		logrus.Infof("Layer uid/gid will be mapped using: %+v", *idMappings)
+	}
+	// The env vars having one of the prefixes are passed as build args, CNB_ by default
+	a.ArgSources.Env = model.EnvArgs(os.Environ(), c.ArgEnvPrefixes)
+	if c.ArgsFile != "" {
+		args, err := util.LoadArgsFile(c.LayersFile(c.ArgsFile))
+		if err != nil {
+			return nil, failure.Wrap(failure.Metadata, err)
+		}
+		a.ArgSources.ArgsFile = args
+	}
+	return a, nil
+}
+
+// build builds the Dockerfiles of the metadata file or of the layers dir, phase by phase, or the Dockerfile of the
+// workspace dir when there is no metadata
+func (a *App) build() error {
+	// Roll back the changes of an extraction which has been interrupted during the last run
+	if err := a.Extractor.RecoverJournal(); err != nil {
+		return failure.Wrap(failure.Extract, err)
+	}
+
+	if err := reapChildProcesses(); err != nil {
+		return failure.Wrap(failure.Config, err)
+	}
+
+	if !a.useMetadata() {
+		// When no metadata.toml file is used, parse the dockerfile directly
+		pathToDockerFile := filepath.Join(a.Config.WorkspaceDir, a.Config.DockerfileName)
+		logrus.Infof("Dockerfile path: %s", pathToDockerFile)
+		buildArgs := a.ArgSources.Resolve(model.Dockerfile{}, model.PhaseBuild)
+		logArgs(model.PhaseBuild, buildArgs)
+		_, err := a.buildDockerfile(model.Dockerfile{}, engine.Request{
+			Phase:      model.PhaseBuild,
+			Dockerfile: pathToDockerFile,
+			ContextDir: a.Config.WorkspaceDir,
+			Args:       buildArgs,
+		})
+		return err
+	}
+
+	metadata, extensions, err := a.loadMetadata(a.Config.Lenient)
+	if err != nil {
+		return err
+	}
+	// The run Dockerfiles are built against the run image once the build image has been extended
+	extensionLayers, err := a.buildPhase(metadata, extensions, model.PhaseBuild)
+	if err != nil {
+		return err
+	}
+	runExtensionLayers, err := a.buildPhase(metadata, extensions, model.PhaseRun)
+	if err != nil {
+		return err
+	}
+	extensionLayers = append(extensionLayers, runExtensionLayers...)
+	if a.Config.Chained {
+		if err := util.WriteJSON(a.Config.ExtensionLayersFile, extensionLayers); err != nil {
+			return failure.Wrap(failure.Export, err)
+		}
+		logrus.Infof("Ordered list of the extension layers stored at %s", a.Config.ExtensionLayersFile)
+	}
+	return nil
+}
+
+// buildPhase builds the Dockerfiles selected for a phase and returns, in chained mode, the layers added by each of them.
+// In chained mode, the base_image of a Dockerfile is the image produced by the previous one of the phase
+func (a *App) buildPhase(metadata model.Metadata, extensions map[string]model.Extension, phase model.Phase) ([]model.ExtensionLayers, error) {
+	var extensionLayers []model.ExtensionLayers
+	previousImage := ""
+	for _, dockerFile := range metadata.Dockerfiles {
+		pathToDockerFile, contextDir := dockerFile.Paths(a.Config.WorkspaceDir)
+		if reason := a.Config.Filter.SkipReason(dockerFile, phase); reason != "" {
+			logrus.Infof("%s of the Dockerfile %s skipped: %s", phaseName(phase), pathToDockerFile, reason)
+			continue
+		}
+		extension := model.DockerfileExtension(extensions, dockerFile)
+		logrus.Infof("%s Dockerfile path: %s, extension: %s", phaseName(phase), pathToDockerFile, extension)
+
+		// The args of a Dockerfile are not passed to the next ones
+		args := a.dockerfileArgs(dockerFile, phase, previousImage)
+		logArgs(phase, args)
+		req := engine.Request{
+			Phase:      phase,
+			Dockerfile: pathToDockerFile,
+			ContextDir: contextDir,
+			Args:       args,
+			Secrets:    dockerFile.Secrets,
+		}
+		var img engine.Image
+		var err error
+		if phase == model.PhaseRun {
+			img, err = a.buildRunDockerfile(extension, req)
+		} else {
+			img, err = a.buildDockerfile(dockerFile, req)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if a.Config.Chained {
+			baseImage, _ := model.LookupArg(args, baseImageArg)
+			extensionLayers = append(extensionLayers, model.ExtensionLayers{
+				ExtensionID:      extension.ID,
+				ExtensionName:    extension.Name,
+				ExtensionVersion: extension.Version,
+				Phase:            phase,
+				Dockerfile:       pathToDockerFile,
+				BaseImage:        baseImage.Value,
+				Image:            img.Reference,
+				Layers:           extendedLayers(img.Layers),
+			})
+			previousImage = img.Reference
+		}
+	}
+	return extensionLayers, nil
+}
+
+// buildDockerfile builds a Dockerfile of the build phase and applies the new layers of the image to the root FS dir
+func (a *App) buildDockerfile(dockerFile model.Dockerfile, req engine.Request) (engine.Image, error) {
+	// Launch a timer to measure the time needed to build/extract
+	start := time.Now()
+
+	// The overwrite policy of the Dockerfile overrides the global one
+	a.Extractor.OverwritePolicy = a.Config.OverwritePolicy
+	if dockerFile.OverwritePolicy != "" {
+		policy, err := layer.ParseOverwritePolicy(string(dockerFile.OverwritePolicy))
+		if err != nil {
+			return engine.Image{}, failure.Wrapf(failure.Metadata, err, "Dockerfile %s", dockerFile.Path)
+		}
+		a.Extractor.OverwritePolicy = policy
+	}
+	logrus.Infof("Overwrite policy: %s", a.Extractor.OverwritePolicy)
+
+	img, err := a.Engine.Build(req)
+	if err != nil {
+		return engine.Image{}, failure.Wrapf(failure.Build, err, "build of the Dockerfile %s failed", req.Dockerfile)
+	}
+	logrus.Infof("Image %s built with %d new layer(s)", img.Reference, len(img.Layers))
+	a.Extractor.Dockerfile = req.Dockerfile
+	if err := a.Extractor.Apply(img.Layers); err != nil {
+		return engine.Image{}, failure.Wrapf(failure.Extract, err, "layers of the Dockerfile %s cannot be extracted", req.Dockerfile)
+	}
+
+	// Check if files exist
+	if len(a.Config.FilesToSearch) > 0 {
+		if _, err := util.FindFiles(a.Config.RootFSDir, a.Config.FilesToSearch, a.Config.IgnorePaths); err != nil {
+			return engine.Image{}, failure.Wrap(failure.Verify, err)
+		}
+	}
+
+	// Time elapsed is ...
+	logrus.Infof("Time elapsed: %s", time.Since(start))
+	return img, nil
+}
+
+// buildRunDockerfile builds a run Dockerfile against the run image, passed as base_image arg with the other run args.
+// The extended run image is stored as an OCI layout under the run dir, next to the list of the layers added on top of
+// the run image. Nothing is extracted to the root FS dir
+func (a *App) buildRunDockerfile(extension model.Extension, req engine.Request) (engine.Image, error) {
+	// Launch a timer to measure the time needed to build/store the run image
+	start := time.Now()
+
+	runImage, _ := model.LookupArg(req.Args, baseImageArg)
+	logrus.Infof("Building the run image extension %s using the run image: %s", req.Dockerfile, runImage.Value)
+	dir := filepath.Join(a.Config.RunDir, util.ExtensionDirName(extension.ID, req.Dockerfile))
+	req.Layout = filepath.Join(dir, runImageLayoutName)
+	img, err := a.Engine.Build(req)
+	if err != nil {
+		return engine.Image{}, failure.Wrapf(failure.Build, err, "build of the run image extension %s failed", req.Dockerfile)
+	}
+
+	ext := model.RunImageExtension{
+		ExtensionID:      extension.ID,
+		ExtensionName:    extension.Name,
+		ExtensionVersion: extension.Version,
+		Dockerfile:       req.Dockerfile,
+		RunImage:         runImage.Value,
+		Layout:           req.Layout,
+		Digest:           img.Digest,
+		Layers:           extendedLayers(img.Layers),
+	}
+	extFile := filepath.Join(dir, runImageExtensionFileName)
+	if err := util.WriteJSON(extFile, ext); err != nil {
+		return engine.Image{}, failure.Wrap(failure.Export, err)
+	}
+	logrus.Infof("Run image %s extended with %d layer(s), stored at %s", ext.Digest, len(ext.Layers), ext.Layout)
+	logrus.Infof("Extended layers of the run image listed in %s", extFile)
+
+	// Time elapsed is ...
+	logrus.Infof("Time elapsed: %s", time.Since(start))
+	return img, nil
+}
+
+// logConfig logs the settings of the app
+func (a *App) logConfig() {
+	c := a.Config
+	logrus.Infof("Engine: %s", a.Engine.Name())
+	logrus.Infof("Workspace   dir: %s", c.WorkspaceDir)
+	logrus.Infof("Cache       dir: %s", c.CacheDir)
+	logrus.Infof("Layers      dir: %s", c.LayersDir)
+	logrus.Infof("Group      file: %s", c.GroupFile)
+	logrus.Infof("Metadata toml file: %s", c.MetadataFile)
+	logrus.Infof("Dockerfile name: %s", c.DockerfileName)
+	logrus.Infof("Extract layer files ? %v", c.ExtractLayers)
+	logrus.Infof("Preserve file attributes ? %v", c.PreserveAttributes)
+	logrus.Infof("Overwrite policy: %s", c.OverwritePolicy)
+	logrus.Infof("Root FS     dir: %s", c.RootFSDir)
+	logrus.Infof("Dry run ? %v", c.DryRun)
+	logrus.Infof("Run image: %s", c.RunImage)
+	logrus.Infof("Run         dir: %s", c.RunDir)
+	logrus.Infof("Chained extensions ? %v", c.Chained)
+	logrus.Infof("Phase: %s, extensions included: %v, excluded: %v", c.Filter.Phase, c.Filter.Include, c.Filter.Exclude)
+	logrus.Infof("Lenient metadata validation ? %v", c.Lenient)
+	logrus.Infof("Dockerfile lint level: %s", c.LintLevel)
+	logrus.Infof("Build args of the env vars having the prefixes %v: %v", c.ArgEnvPrefixes, argNames(a.ArgSources.Env))
+	logrus.Infof("Build args of the args file %s: %v", c.ArgsFile, argNames(a.ArgSources.ArgsFile))
+}
+
+// execDebugger restarts the application under the Delve debugger, which listens on the port 2345, with the same command
+// line args
+func execDebugger(cmdArgs []string) {
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	args := []string{
+		"--listen=:2345",
+		"--headless=true",
+		"--api-version=2",
+		"--accept-multiclient",
+		"exec",
+		executable, "--", fromDebuggerArg,
+	}
+	args = append(args, cmdArgs...)
+	err = syscall.Exec("/usr/local/bin/dlv", append([]string{"/usr/local/bin/dlv"}, args...), os.Environ())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// extendedLayers returns the description of the layers
+func extendedLayers(layers []extract.Layer) []model.ExtendedLayer {
+	var extended []model.ExtendedLayer
+	for _, l := range layers {
+		extended = append(extended, l.ExtendedLayer)
+	}
+	return extended
+}
+
+// phaseName returns the name of the phase used in the logs
+func phaseName(phase model.Phase) string {
+	if phase == model.PhaseRun {
+		return "Run"
+	}
+	return "Build"
+}
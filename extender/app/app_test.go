@@ -0,0 +1,212 @@
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/redhat-buildpacks/poc/extender/config"
+	"github.com/redhat-buildpacks/poc/extender/engine"
+	"github.com/redhat-buildpacks/poc/extender/extract"
+	"github.com/redhat-buildpacks/poc/extender/failure"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/layer/layertest"
+)
+
+// fakeEngine records the requests and builds images having one layer, which contains a file named after the Dockerfile
+type fakeEngine struct {
+	requests []engine.Request
+}
+
+func (e *fakeEngine) Name() string {
+	return "fake"
+}
+
+func (e *fakeEngine) ParseDockerfile(path string) ([]model.Instruction, error) {
+	return nil, nil
+}
+
+func (e *fakeEngine) Build(req engine.Request) (engine.Image, error) {
+	e.requests = append(e.requests, req)
+	n := len(e.requests)
+	name := filepath.Base(filepath.Dir(req.Dockerfile)) + ".txt"
+	l := extract.Layer{
+		ExtendedLayer: model.ExtendedLayer{Digest: fmt.Sprintf("sha256:%d", n)},
+		Open: func() (io.ReadCloser, error) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Uid: os.Getuid(), Gid: os.Getgid()}); err != nil {
+				return nil, err
+			}
+			if err := tw.Close(); err != nil {
+				return nil, err
+			}
+			return io.NopCloser(&buf), nil
+		},
+	}
+	return engine.Image{Reference: fmt.Sprintf("image-%d", n), Digest: fmt.Sprintf("sha256:manifest-%d", n), Layers: []extract.Layer{l}}, nil
+}
+
+func TestBuildPhase(t *testing.T) {
+	c := &config.Config{
+		WorkspaceDir:  t.TempDir(),
+		RootFSDir:     t.TempDir(),
+		RunDir:        t.TempDir(),
+		RunImage:      "run-image",
+		Chained:       true,
+		ExtractLayers: true,
+	}
+	c.JournalFile = filepath.Join(t.TempDir(), "journal.json")
+	c.JournalBackupDir = filepath.Join(filepath.Dir(c.JournalFile), "journal")
+	e := &fakeEngine{}
+	a, err := New(c, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.ArgSources = model.ArgSources{CLI: []model.ResolvedArg{{Name: "cli", Value: "1", Source: model.SourceCLI}}}
+	metadata := model.Metadata{Dockerfiles: []model.Dockerfile{
+		{ExtensionID: "curl", Path: "curl/Dockerfile", Build: boolPtr(true), Run: boolPtr(true)},
+		{ExtensionID: "ozzy", Path: "ozzy/Dockerfile", Build: boolPtr(true), Run: boolPtr(false)},
+	}}
+	extensions := map[string]model.Extension{}
+
+	build, err := a.buildPhase(metadata, extensions, model.PhaseBuild)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := a.buildPhase(metadata, extensions, model.PhaseRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var baseImages []string
+	for _, req := range e.requests {
+		baseImage, _ := model.LookupArg(req.Args, baseImageArg)
+		baseImages = append(baseImages, baseImage.Value)
+		if cli, _ := model.LookupArg(req.Args, "cli"); cli.Value != "1" {
+			t.Errorf("%s: the command line arg is missing: %v", req.Dockerfile, req.Args)
+		}
+	}
+	// The second build Dockerfile is built on top of the first one, the run Dockerfile against the run image
+	if want := []string{"", "image-1", "run-image"}; !reflect.DeepEqual(baseImages, want) {
+		t.Errorf("base images: got %v, want %v", baseImages, want)
+	}
+	if len(build) != 2 || build[1].BaseImage != "image-1" || build[1].Image != "image-2" {
+		t.Errorf("unexpected build extension layers %+v", build)
+	}
+
+	// The layers of the build Dockerfiles are extracted
+	for _, name := range []string{"curl.txt", "ozzy.txt"} {
+		if _, err := os.Stat(filepath.Join(c.RootFSDir, name)); err != nil {
+			t.Errorf("%s not extracted: %v", name, err)
+		}
+	}
+	if e.requests[0].Layout != "" || e.requests[2].Layout == "" {
+		t.Errorf("only the run image must be stored as an OCI layout: %+v", e.requests)
+	}
+
+	if len(run) != 1 || run[0].Phase != model.PhaseRun || run[0].Image != "image-3" {
+		t.Fatalf("unexpected run extension layers %+v", run)
+	}
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(e.requests[2].Layout), runImageExtensionFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ext model.RunImageExtension
+	if err := json.Unmarshal(content, &ext); err != nil {
+		t.Fatal(err)
+	}
+	if ext.RunImage != "run-image" || ext.Digest != "sha256:manifest-3" || len(ext.Layers) != 1 {
+		t.Errorf("unexpected run image extension %+v", ext)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	// Each command defines its flags once
+	for _, cmd := range commands {
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		config.AddFlags(fs, cmd.settings...)
+		if cmd.flags != nil {
+			cmd.flags(fs, &options{})
+		}
+	}
+
+	// The flags can be given after the positional args
+	base := t.TempDir()
+	rootFSDir := filepath.Join(base, "root")
+	layerFile := layertest.WriteLayer(t, base, false, []layertest.Entry{{Name: "curl", Typeflag: tar.TypeReg, Mode: 0755}})
+	// The extract and verify commands do not create the engine
+	if err := Execute("extender", []string{"extract", layerFile, "--root-fs-dir", rootFSDir, "--cache-dir=" + base}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Execute("extender", []string{"verify", "--root-fs-dir", rootFSDir, "curl"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each error has the category of the step which failed
+	for _, tc := range []struct {
+		cmdArgs  []string
+		category failure.Category
+	}{
+		{[]string{"unknown"}, failure.Config},
+		{[]string{"extract"}, failure.Config},
+		{[]string{"verify", "--dry-run"}, failure.Config},
+		{[]string{"verify", "--root-fs-dir", rootFSDir, "curl", "wget"}, failure.Verify},
+		{[]string{"extract", filepath.Join(base, "missing"), "--root-fs-dir", rootFSDir, "--cache-dir=" + base}, failure.Config},
+		{[]string{"extract", base, "--root-fs-dir", rootFSDir, "--cache-dir=" + base}, failure.Extract},
+	} {
+		err := Execute("extender", tc.cmdArgs)
+		if err == nil {
+			t.Errorf("%v: expected an error", tc.cmdArgs)
+		} else if failure.CategoryOf(err) != tc.category {
+			t.Errorf("%v: got the category %q, want %q: %s", tc.cmdArgs, failure.CategoryOf(err), tc.category, err)
+		}
+	}
+}
+
+func TestExecuteEngine(t *testing.T) {
+	workspaceDir := t.TempDir()
+	created := 0
+	engine.Register("fake", func(c *config.Config) (engine.Engine, error) {
+		created++
+		if c.WorkspaceDir != workspaceDir {
+			t.Errorf("unexpected config %+v", c)
+		}
+		return &fakeEngine{}, nil
+	})
+	engine.Register("broken", func(c *config.Config) (engine.Engine, error) {
+		return nil, errors.New("storage unavailable")
+	})
+
+	// The selected engine is created, then the command fails as there is no metadata
+	err := Execute("extender", []string{"validate", "--engine", "fake", "--workspace-dir", workspaceDir})
+	if created != 1 || failure.CategoryOf(err) != failure.Metadata {
+		t.Errorf("engine created %d time(s), unexpected error %v", created, err)
+	}
+
+	// An engine must be selected when several are registered, and it must be registered
+	for _, cmdArgs := range [][]string{
+		{"validate", "--workspace-dir", workspaceDir},
+		{"validate", "--engine", "kaniko", "--workspace-dir", workspaceDir},
+		{"validate", "--engine", "broken", "--workspace-dir", workspaceDir},
+	} {
+		if err := Execute("extender", cmdArgs); failure.CategoryOf(err) != failure.Config {
+			t.Errorf("%v: unexpected error %v", cmdArgs, err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("engine created %d time(s)", created)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"github.com/redhat-buildpacks/poc/extender/failure"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/extender/util"
+	"github.com/sirupsen/logrus"
+)
+
+// dockerfileArgs resolves the args passed to a Dockerfile during a phase. In chained mode, the base_image arg is the
+// image of the previous extension of the phase
+func (a *App) dockerfileArgs(d model.Dockerfile, phase model.Phase, previousImage string) []model.ResolvedArg {
+	args := a.ArgSources.Resolve(d, phase)
+	if previousImage != "" {
+		args = model.SetArg(args, model.ResolvedArg{Name: baseImageArg, Value: previousImage, Source: model.SourcePreviousExtension})
+	} else if _, ok := model.LookupArg(args, baseImageArg); !ok && phase == model.PhaseRun && a.Config.RunImage != "" {
+		args = append(args, model.ResolvedArg{Name: baseImageArg, Value: a.Config.RunImage, Source: model.SourceRunImage})
+	}
+	return args
+}
+
+// logArgs logs the args passed to a Dockerfile and where their value comes from
+func logArgs(phase model.Phase, args []model.ResolvedArg) {
+	for _, arg := range args {
+		logrus.Infof("%s arg: %s", phase, arg)
+	}
+}
+
+// argNames returns the names of the args, whose values must not be logged as they may be secrets
+func argNames(args []model.ResolvedArg) []string {
+	var names []string
+	for _, arg := range args {
+		names = append(names, arg.Name)
+	}
+	return names
+}
+
+// reportArgs cross-references the ARG instructions of the Dockerfiles with the args passed to them, for each phase,
+// and stores the reports as a JSON file
+func (a *App) reportArgs(metadata model.Metadata) error {
+	var reports []model.ArgsReport
+	for _, d := range metadata.Dockerfiles {
+		pathToDockerFile, _ := d.Paths(a.Config.WorkspaceDir)
+		instructions, err := a.Engine.ParseDockerfile(pathToDockerFile)
+		if err != nil {
+			return failure.Wrapf(failure.Metadata, err, "Dockerfile %s cannot be parsed", pathToDockerFile)
+		}
+		for _, phase := range []model.Phase{model.PhaseBuild, model.PhaseRun} {
+			if a.Config.Filter.SkipReason(d, phase) != "" {
+				continue
+			}
+			report := model.NewArgsReport(pathToDockerFile, phase, instructions, a.dockerfileArgs(d, phase, ""))
+			for _, arg := range report.Declared {
+				switch arg.Status {
+				case model.ArgMissing:
+					logrus.Warnf("%s:%d: %s arg %s has no value", pathToDockerFile, arg.Line, phase, arg.Name)
+				case model.ArgDefault:
+					logrus.Infof("%s:%d: %s arg %s=%s (default value)", pathToDockerFile, arg.Line, phase, arg.Name, arg.Value)
+				default:
+					logrus.Infof("%s:%d: %s arg %s=%s (%s)", pathToDockerFile, arg.Line, phase, arg.Name, arg.Value, arg.Source)
+				}
+			}
+			for _, arg := range report.Unused {
+				// The CNB env vars are passed to all the Dockerfiles
+				if arg.Source == model.SourceEnv {
+					logrus.Debugf("%s: %s arg %s is not declared", pathToDockerFile, phase, arg.Name)
+					continue
+				}
+				logrus.Warnf("%s: %s arg %s=%s (%s) is not declared by the Dockerfile", pathToDockerFile, phase, arg.Name, arg.Value, arg.Source)
+			}
+			if a.Config.RenderDockerfiles {
+				logrus.Infof("Effective Dockerfile %s (%s):\n%s", pathToDockerFile, phase, report.EffectiveDockerfile)
+			}
+			reports = append(reports, report)
+		}
+	}
+	if err := util.WriteJSON(a.Config.ArgsReportFile, reports); err != nil {
+		return failure.Wrap(failure.Export, err)
+	}
+	logrus.Infof("Args report stored at %s", a.Config.ArgsReportFile)
+	return nil
+}
@@ -0,0 +1,329 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/redhat-buildpacks/poc/extender/config"
+	"github.com/redhat-buildpacks/poc/extender/engine"
+	"github.com/redhat-buildpacks/poc/extender/failure"
+	"github.com/redhat-buildpacks/poc/extender/logging"
+	"github.com/redhat-buildpacks/poc/extender/model"
+)
+
+const defaultCommand = "build"
+
+var (
+	loggingSettings = []string{
+		config.CONFIG_FILE_ENV_NAME,
+		config.LOGGING_LEVEL_ENV_NAME,
+		config.LOGGING_FORMAT_ENV_NAME,
+		config.LOGGING_TIMESTAMP_ENV_NAME,
+	}
+	// metadataSettings create the engine, select the Dockerfiles and resolve their args
+	metadataSettings = []string{
+		config.ENGINE_ENV_NAME,
+		config.GRAPH_DRIVER_ENV_NAME,
+		config.STORAGE_ROOT_PATH_ENV_NAME,
+		config.STORAGE_RUN_ROOT_PATH_ENV_NAME,
+		config.IGNORE_PATHS_ENV_NAME,
+		config.KANIKO_DIR_ENV_NAME,
+		config.WORKSPACE_DIR_ENV_NAME,
+		config.LAYERS_DIR_ENV_NAME,
+		config.GROUP_FILE_ENV_NAME,
+		config.METADATA_FILE_NAME_ENV_NAME,
+		config.DOCKERFILE_NAME_ENV_NAME,
+		config.LENIENT_ENV_NAME,
+		config.DOCKERFILE_LINT_ENV_NAME,
+		config.PHASE_ENV_NAME,
+		config.EXTENSION_IDS_ENV_NAME,
+		config.EXCLUDE_EXTENSION_IDS_ENV_NAME,
+		config.RUN_IMAGE_ENV_NAME,
+		config.ARG_ENV_PREFIXES_ENV_NAME,
+		config.ARGS_FILE_ENV_NAME,
+	}
+	// extractSettings apply the layers to the root FS dir
+	extractSettings = []string{
+		config.CACHE_DIR_ENV_NAME,
+		config.ROOT_FS_DIR_ENV_NAME,
+		config.PRESERVE_ATTRIBUTES_ENV_NAME,
+		config.REMAP_IDS_ENV_NAME,
+		config.OVERWRITE_POLICY_ENV_NAME,
+		config.DRY_RUN_ENV_NAME,
+		config.BACKUP_DIR_ENV_NAME,
+		config.PLAN_FILE_ENV_NAME,
+		config.JOURNAL_FILE_ENV_NAME,
+		config.JOURNAL_BACKUP_DIR_ENV_NAME,
+	}
+)
+
+// command is a command of the command line
+type command struct {
+	name     string
+	args     string // Positional args of the command, e.g. <oci-layout|tar>
+	summary  string
+	settings []string // Env vars of the settings of the command, mirrored by its flags
+	engine   bool     // The engine is created to build or to parse the Dockerfiles
+	minArgs  int
+	maxArgs  int // -1 when the number of args is not limited
+	flags    func(fs *flag.FlagSet, o *options)
+	run      func(a *App, o *options, args []string) error
+}
+
+// options are the flags of a command which are not settings
+type options struct {
+	buildArgs argFlags
+	layers    listFlag
+}
+
+func buildArgFlag(fs *flag.FlagSet, o *options) {
+	fs.Var(&o.buildArgs, "build-arg", "Arg passed to all the Dockerfiles as name=value. Can be repeated, the last value wins")
+}
+
+var commands = []command{
+	{
+		name:     "build",
+		summary:  "Build the Dockerfiles phase by phase and extract the new layers to the root FS dir (default command)",
+		settings: concat(loggingSettings, metadataSettings, extractSettings, []string{config.EXTRACT_LAYERS_ENV_NAME, config.FILES_TO_SEARCH_ENV_NAME, config.RUN_DIR_ENV_NAME, config.CHAINED_ENV_NAME, config.EXTENSION_LAYERS_FILE_ENV_NAME}),
+		engine:   true,
+		flags:    buildArgFlag,
+		run: func(a *App, o *options, args []string) error {
+			return a.build()
+		},
+	},
+	{
+		name:     "extract",
+		args:     "<oci-layout|tar>",
+		summary:  "Extract the layers of an OCI layout dir, or a layer tar file, to the root FS dir without building anything",
+		settings: concat(loggingSettings, extractSettings),
+		minArgs:  1,
+		maxArgs:  1,
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.Var(&o.layers, "layers", "Comma separated digests of the layers of the OCI layout to be extracted, e.g. the layers listed in extended-layers.json. Default is all")
+		},
+		run: func(a *App, o *options, args []string) error {
+			return a.extract(args[0], o.layers)
+		},
+	},
+	{
+		name:     "inspect",
+		summary:  "Print as JSON the Dockerfiles to be built per phase with their args, or the reason why they are skipped",
+		settings: concat(loggingSettings, metadataSettings, []string{config.CHAINED_ENV_NAME}),
+		engine:   true,
+		flags:    buildArgFlag,
+		run: func(a *App, o *options, args []string) error {
+			return a.inspect()
+		},
+	},
+	{
+		name:     "verify",
+		args:     "[file...]",
+		summary:  "Verify that the files to search, and the files given, exist under the root FS dir",
+		settings: concat(loggingSettings, []string{config.ROOT_FS_DIR_ENV_NAME, config.FILES_TO_SEARCH_ENV_NAME, config.IGNORE_PATHS_ENV_NAME}),
+		maxArgs:  -1,
+		run: func(a *App, o *options, args []string) error {
+			return a.verify(append(a.Config.FilesToSearch, args...))
+		},
+	},
+	{
+		name:     "validate",
+		summary:  "Report the problems of the metadata file and lint the Dockerfiles without building anything",
+		settings: concat(loggingSettings, metadataSettings),
+		engine:   true,
+		run: func(a *App, o *options, args []string) error {
+			return a.validate()
+		},
+	},
+	{
+		name:     "args",
+		summary:  "Report the args of the Dockerfiles which are unused, missing or defaulted",
+		settings: concat(loggingSettings, metadataSettings, []string{config.CACHE_DIR_ENV_NAME, config.RENDER_DOCKERFILES_ENV_NAME, config.ARGS_REPORT_FILE_ENV_NAME}),
+		engine:   true,
+		flags:    buildArgFlag,
+		run: func(a *App, o *options, args []string) error {
+			return a.args()
+		},
+	},
+	{
+		name:     "rollback",
+		summary:  "Undo the changes done on the root FS dir by the layers extracted during the last runs",
+		settings: concat(loggingSettings, []string{config.CACHE_DIR_ENV_NAME, config.ROOT_FS_DIR_ENV_NAME, config.JOURNAL_FILE_ENV_NAME}),
+		run: func(a *App, o *options, args []string) error {
+			return failure.Wrap(failure.Extract, a.Extractor.Rollback())
+		},
+	},
+	{
+		name:     "config",
+		args:     "view",
+		summary:  "Print the effective config, merged from the flags, the env vars, the config file and the defaults, with where each value comes from",
+		settings: allSettings(),
+		minArgs:  1,
+		maxArgs:  1,
+		run: func(a *App, o *options, args []string) error {
+			return a.config(args[0])
+		},
+	},
+}
+
+// Execute executes the command of the command line args. The build command is executed when the args do not start
+// with a command. The engine selected by the ENGINE setting is created for the commands building or parsing the
+// Dockerfiles
+func Execute(program string, cmdArgs []string) error {
+	name := defaultCommand
+	if len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+		name, cmdArgs = cmdArgs[0], cmdArgs[1:]
+	} else if len(cmdArgs) > 0 && (cmdArgs[0] == "-h" || cmdArgs[0] == "--help") {
+		name = "help"
+	}
+	if name == "help" {
+		usage(os.Stdout, program)
+		return nil
+	}
+	cmd, ok := lookupCommand(name)
+	if !ok {
+		usage(os.Stderr, program)
+		return failure.New(failure.Config, "unknown command %q", name)
+	}
+
+	fs := flag.NewFlagSet(program+" "+cmd.name, flag.ContinueOnError)
+	config.AddFlags(fs, cmd.settings...)
+	o := &options{}
+	if cmd.flags != nil {
+		cmd.flags(fs, o)
+	}
+	fs.Usage = func() {
+		commandUsage(fs.Output(), program, cmd, fs)
+	}
+	args, err := parseInterspersed(fs, cmdArgs)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return failure.Wrap(failure.Config, err)
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		fs.Usage()
+		return failure.New(failure.Config, "%s: unexpected args %v", cmd.name, args)
+	}
+
+	c, err := config.FromFlags(fs)
+	if err != nil {
+		return failure.Wrap(failure.Config, err)
+	}
+	if err := logging.Configure(c.LogLevel, c.LogFormat, c.LogTimestamp); err != nil {
+		return failure.Wrap(failure.Config, err)
+	}
+	var e engine.Engine
+	if cmd.engine {
+		if e, err = engine.New(c.Engine, c); err != nil {
+			return failure.Wrapf(failure.Config, err, "engine %s cannot be created", c.Engine)
+		}
+	}
+	a, err := New(c, e)
+	if err != nil {
+		return err
+	}
+	a.ArgSources.CLI = o.buildArgs
+	if cmd.engine {
+		a.logConfig()
+	}
+	return cmd.run(a, o, args)
+}
+
+// parseInterspersed parses the flags given before or after the positional args and returns the positional args
+func parseInterspersed(fs *flag.FlagSet, cmdArgs []string) ([]string, error) {
+	var args []string
+	for {
+		if err := fs.Parse(cmdArgs); err != nil {
+			return nil, err
+		}
+		cmdArgs = fs.Args()
+		if len(cmdArgs) == 0 {
+			return args, nil
+		}
+		args = append(args, cmdArgs[0])
+		cmdArgs = cmdArgs[1:]
+	}
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// usage prints the commands and the precedence of the flags, the env vars and the default values
+func usage(w io.Writer, program string) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags] [args]\n\nCommands:\n", program)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, `
+Each flag mirrors an env var, e.g. --dry-run and DRY_RUN, and a key of the TOML config file given by --config-file,
+e.g. dry_run of the extract table. A flag has the precedence over the env var, which has the precedence over the config
+file, which has the precedence over the default value. The --build-arg flags have the precedence over the args of the metadata file, of
+the args file and of the env vars.
+
+Use "%s <command> --help" for more information about a command.
+`, program)
+}
+
+// commandUsage prints the usage of a command and its flags
+func commandUsage(w io.Writer, program string, cmd command, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: %s %s [flags] %s\n\n%s\n\nFlags:\n", program, cmd.name, cmd.args, cmd.summary)
+	fs.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(w, "  --%s\n    \t%s\n", f.Name, f.Usage)
+	})
+}
+
+// allSettings returns the env vars of all the settings
+func allSettings() []string {
+	var names []string
+	for _, s := range config.Settings {
+		names = append(names, s.EnvName)
+	}
+	return names
+}
+
+func concat(lists ...[]string) []string {
+	var all []string
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	return all
+}
+
+// argFlags are the args given by the --build-arg flags
+type argFlags []model.ResolvedArg
+
+func (f *argFlags) String() string {
+	return strings.Join(argNames(*f), ",")
+}
+
+func (f *argFlags) Set(s string) error {
+	arg, err := model.ParseArg(s, model.SourceCLI)
+	if err != nil {
+		return err
+	}
+	*f = model.SetArg(*f, arg)
+	return nil
+}
+
+// listFlag is a comma separated list
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(s string) error {
+	*f = append(*f, strings.Split(s, ",")...)
+	return nil
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/redhat-buildpacks/poc/extender/config"
+	"github.com/redhat-buildpacks/poc/extender/extract"
+	"github.com/redhat-buildpacks/poc/extender/failure"
+	"github.com/redhat-buildpacks/poc/extender/logging"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/extender/util"
+	"github.com/sirupsen/logrus"
+)
+
+// inspectedDockerfile is a Dockerfile reported by the inspect command for a phase
+type inspectedDockerfile struct {
+	ExtensionID      string              `json:"extension_id,omitempty"`
+	ExtensionVersion string              `json:"extension_version,omitempty"`
+	Phase            model.Phase         `json:"phase"`
+	Dockerfile       string              `json:"dockerfile"`
+	ContextDir       string              `json:"context_dir"`
+	Skipped          string              `json:"skipped,omitempty"`
+	Args             []model.ResolvedArg `json:"args,omitempty"`
+}
+
+// validate reports the problems of the metadata file without building anything
+func (a *App) validate() error {
+	if !a.useMetadata() {
+		return failure.New(failure.Metadata, "nothing to validate: %s is not defined and the group file %s does not exist", config.METADATA_FILE_NAME_ENV_NAME, a.Config.GroupFile)
+	}
+	if _, _, err := a.loadMetadata(false); err != nil {
+		return err
+	}
+	logrus.Info("The Dockerfiles and their extensions are valid")
+	return nil
+}
+
+// args reports the args of the Dockerfiles which are unused, missing or defaulted
+func (a *App) args() error {
+	if !a.useMetadata() {
+		return failure.New(failure.Metadata, "no Dockerfiles to report: %s is not defined and the group file %s does not exist", config.METADATA_FILE_NAME_ENV_NAME, a.Config.GroupFile)
+	}
+	metadata, _, err := a.loadMetadata(a.Config.Lenient)
+	if err != nil {
+		return err
+	}
+	return a.reportArgs(metadata)
+}
+
+// extract applies the layers of an OCI layout dir, or of a layer tar file, to the root FS dir
+func (a *App) extract(path string, digests []string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return failure.Wrap(failure.Config, err)
+	}
+	var layers []extract.Layer
+	if info.IsDir() {
+		if layers, err = extract.LayoutLayers(path, digests); err != nil {
+			return failure.Wrap(failure.Extract, err)
+		}
+	} else {
+		if len(digests) > 0 {
+			return failure.New(failure.Config, "the layers can only be selected from an OCI layout dir, %s is a file", path)
+		}
+		layers = []extract.Layer{extract.FileLayer(path)}
+	}
+	logrus.Infof("%d layer(s) of %s to be extracted to %s", len(layers), path, a.Config.RootFSDir)
+
+	// Roll back the changes of an extraction which has been interrupted during the last run
+	if err := a.Extractor.RecoverJournal(); err != nil {
+		return failure.Wrap(failure.Extract, err)
+	}
+	a.Extractor.Extract = true
+	return failure.Wrap(failure.Extract, a.Extractor.Apply(layers))
+}
+
+// inspect prints the Dockerfiles to be built, phase by phase, with the args passed to them. In chained mode, the
+// base_image of a Dockerfile will be the image produced by the previous one of the phase
+func (a *App) inspect() error {
+	var dockerfiles []inspectedDockerfile
+	if !a.useMetadata() {
+		pathToDockerFile := filepath.Join(a.Config.WorkspaceDir, a.Config.DockerfileName)
+		dockerfiles = append(dockerfiles, inspectedDockerfile{
+			Phase:      model.PhaseBuild,
+			Dockerfile: pathToDockerFile,
+			ContextDir: a.Config.WorkspaceDir,
+			Args:       a.ArgSources.Resolve(model.Dockerfile{}, model.PhaseBuild),
+		})
+	} else {
+		metadata, extensions, err := a.loadMetadata(a.Config.Lenient)
+		if err != nil {
+			return err
+		}
+		for _, phase := range []model.Phase{model.PhaseBuild, model.PhaseRun} {
+			for _, d := range metadata.Dockerfiles {
+				pathToDockerFile, contextDir := d.Paths(a.Config.WorkspaceDir)
+				extension := model.DockerfileExtension(extensions, d)
+				inspected := inspectedDockerfile{
+					ExtensionID:      extension.ID,
+					ExtensionVersion: extension.Version,
+					Phase:            phase,
+					Dockerfile:       pathToDockerFile,
+					ContextDir:       contextDir,
+					Skipped:          a.Config.Filter.SkipReason(d, phase),
+				}
+				if inspected.Skipped == "" {
+					inspected.Args = a.dockerfileArgs(d, phase, "")
+				}
+				dockerfiles = append(dockerfiles, inspected)
+			}
+		}
+	}
+
+	content, err := json.MarshalIndent(dockerfiles, "", "  ")
+	if err != nil {
+		return failure.Wrap(failure.Export, err)
+	}
+	// The values of the secrets are redacted as for the logs
+	fmt.Println(logging.RedactString(string(content)))
+	return nil
+}
+
+// verify checks that the files exist under the root FS dir
+func (a *App) verify(filesToSearch []string) error {
+	if len(filesToSearch) == 0 {
+		return failure.New(failure.Config, "no files to verify: %s is not defined and no file is given", config.FILES_TO_SEARCH_ENV_NAME)
+	}
+	found, err := util.FindFiles(a.Config.RootFSDir, filesToSearch, a.Config.IgnorePaths)
+	if err != nil {
+		return failure.Wrap(failure.Verify, err)
+	}
+	names := map[string]bool{}
+	for _, path := range found {
+		names[filepath.Base(path)] = true
+	}
+	var missing []string
+	for _, name := range filesToSearch {
+		if !names[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return failure.New(failure.Verify, "%d file(s) not found under %s: %v", len(missing), a.Config.RootFSDir, missing)
+	}
+	logrus.Infof("The %d file(s) exist under %s", len(filesToSearch), a.Config.RootFSDir)
+	return nil
+}
+
+// config executes a config command: view prints the effective config as a TOML config file
+func (a *App) config(command string) error {
+	if command != "view" {
+		return failure.New(failure.Config, "unknown config command %q, expected: view", command)
+	}
+	a.Config.Print(os.Stdout)
+	return nil
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"os"
+	"strings"
+
+	"github.com/redhat-buildpacks/poc/extender/config"
+	"github.com/redhat-buildpacks/poc/extender/failure"
+	"github.com/redhat-buildpacks/poc/extender/logging"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/extender/util"
+	"github.com/sirupsen/logrus"
+)
+
+// useMetadata tells if the Dockerfiles are listed by a metadata file or by the group file of the layers dir
+func (a *App) useMetadata() bool {
+	if a.Config.MetadataFile != "" {
+		return true
+	}
+	_, err := os.Stat(a.Config.GroupFile)
+	return err == nil
+}
+
+// loadMetadata decodes and validates the metadata file, or discovers the Dockerfiles from the layers dir when no
+// metadata file is defined, then cross-checks the extensions with the extension.toml descriptors of the Dockerfiles.
+// It stops on the first error, or on the problems found in the metadata file unless lenient is true
+func (a *App) loadMetadata(lenient bool) (model.Metadata, map[string]model.Extension, error) {
+	c := a.Config
+	var metadata model.Metadata
+	var err error
+	if c.MetadataFile != "" {
+		metadataFile := c.LayersFile(c.MetadataFile)
+		logrus.Infof("Parsing the Metadata toml file %s to decode it ...", metadataFile)
+		var problems []model.Problem
+		metadata, problems, err = util.LoadMetadata(metadataFile)
+		for _, problem := range problems {
+			if lenient && err == nil {
+				logrus.Warn(problem)
+			} else {
+				logrus.Error(problem)
+			}
+		}
+		if err != nil {
+			return model.Metadata{}, nil, failure.Wrap(failure.Metadata, err)
+		}
+		if len(problems) > 0 && !lenient {
+			return model.Metadata{}, nil, failure.New(failure.Metadata, "%d problem(s) found in the metadata file %s, set %s=true to ignore them", len(problems), metadataFile, config.LENIENT_ENV_NAME)
+		}
+	} else {
+		logrus.Infof("Discovering the Dockerfiles of the layers dir %s using the group file %s ...", c.LayersDir, c.GroupFile)
+		if metadata, err = util.LoadLayersDir(c.WorkspaceDir, c.LayersDir, c.GroupFile); err != nil {
+			return model.Metadata{}, nil, failure.Wrap(failure.Metadata, err)
+		}
+		for _, d := range metadata.Dockerfiles {
+			logrus.Infof("Dockerfile of the extension %s found: %s", d.ExtensionID, d.Path)
+		}
+	}
+
+	if err := a.redactSecrets(metadata); err != nil {
+		return model.Metadata{}, nil, err
+	}
+
+	descriptors, err := util.LoadExtensionDescriptors(c.WorkspaceDir, metadata.Dockerfiles)
+	if err != nil {
+		return model.Metadata{}, nil, failure.Wrap(failure.Metadata, err)
+	}
+	extensions, err := metadata.Extensions(descriptors)
+	if err != nil {
+		return model.Metadata{}, nil, failure.Wrap(failure.Metadata, err)
+	}
+	for _, extension := range extensions {
+		logrus.Infof("Extension: %s, api: %s", extension, extension.API)
+	}
+	if err := a.lintDockerfiles(metadata); err != nil {
+		return model.Metadata{}, nil, err
+	}
+	return metadata, extensions, nil
+}
+
+// redactSecrets reads the secrets of the Dockerfiles so that their values are redacted from the logs, and removes their
+// env vars from the build args
+func (a *App) redactSecrets(metadata model.Metadata) error {
+	for _, d := range metadata.Dockerfiles {
+		for _, secret := range d.Secrets {
+			value, err := util.ReadSecret(secret, a.Config.WorkspaceDir)
+			if err != nil {
+				return failure.Wrap(failure.Metadata, err)
+			}
+			logging.Redact(string(value), strings.TrimSpace(string(value)))
+		}
+	}
+	a.ArgSources = a.ArgSources.WithoutSecrets(metadata.Dockerfiles)
+	return nil
+}
+
+// lintDockerfiles checks the instructions of the extension Dockerfiles, parsed by the engine, before building any of
+// them. It stops when a problem is found and the lint level is error
+func (a *App) lintDockerfiles(metadata model.Metadata) error {
+	lintLevel := a.Config.LintLevel
+	if lintLevel == model.LintOff {
+		return nil
+	}
+	var problems []model.Problem
+	linted := map[string]bool{}
+	for _, d := range metadata.Dockerfiles {
+		pathToDockerFile, _ := d.Paths(a.Config.WorkspaceDir)
+		if linted[pathToDockerFile] {
+			continue
+		}
+		linted[pathToDockerFile] = true
+		instructions, err := a.Engine.ParseDockerfile(pathToDockerFile)
+		if err != nil {
+			return failure.Wrapf(failure.Metadata, err, "Dockerfile %s cannot be parsed", pathToDockerFile)
+		}
+		problems = append(problems, model.LintDockerfile(pathToDockerFile, instructions)...)
+	}
+	for _, problem := range problems {
+		if lintLevel == model.LintError {
+			logrus.Error(problem)
+		} else {
+			logrus.Warn(problem)
+		}
+	}
+	if len(problems) > 0 && lintLevel == model.LintError {
+		return failure.New(failure.Metadata, "%d problem(s) found in the extension Dockerfiles, set %s=%s to build them anyway", len(problems), config.DOCKERFILE_LINT_ENV_NAME, model.LintWarn)
+	}
+	return nil
+}
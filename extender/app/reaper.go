@@ -0,0 +1,45 @@
+package app
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// reapChildProcesses terminates the processes left by the previous builds and waits for them
+func reapChildProcesses() error {
+	procDir, err := os.Open("/proc")
+	if err != nil {
+		return err
+	}
+
+	procDirs, err := procDir.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+
+	tid := os.Getpid()
+
+	var wg sync.WaitGroup
+	for _, dirName := range procDirs {
+		pid, err := strconv.Atoi(dirName)
+		if err == nil && pid != 1 && pid != tid {
+			p, err := os.FindProcess(pid)
+			if err != nil {
+				continue
+			}
+			err = p.Signal(syscall.SIGTERM)
+			if err != nil {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.Wait()
+			}()
+		}
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,304 @@
+// Package config holds the settings shared by the engines, read from the env vars. The settings specific to an engine,
+// e.g. the storage of buildah, are read by the engine itself
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/redhat-buildpacks/poc/extender/logging"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/layer"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ENGINE_ENV_NAME                = "ENGINE"
+	LOGGING_LEVEL_ENV_NAME         = "LOGGING_LEVEL"
+	LOGGING_FORMAT_ENV_NAME        = "LOGGING_FORMAT"
+	LOGGING_TIMESTAMP_ENV_NAME     = "LOGGING_TIMESTAMP"
+	WORKSPACE_DIR_ENV_NAME         = "WORKSPACE_DIR"
+	CACHE_DIR_ENV_NAME             = "CACHE_DIR"
+	LAYERS_DIR_ENV_NAME            = "LAYERS_DIR"
+	GROUP_FILE_ENV_NAME            = "GROUP_FILE"
+	METADATA_FILE_NAME_ENV_NAME    = "METADATA_FILE_NAME"
+	DOCKERFILE_NAME_ENV_NAME       = "DOCKERFILE_NAME"
+	DOCKER_FILE_NAME_ENV_NAME      = "DOCKER_FILE_NAME"
+	EXTRACT_LAYERS_ENV_NAME        = "EXTRACT_LAYERS"
+	PRESERVE_ATTRIBUTES_ENV_NAME   = "PRESERVE_ATTRIBUTES"
+	REMAP_IDS_ENV_NAME             = "REMAP_IDS"
+	OVERWRITE_POLICY_ENV_NAME      = "OVERWRITE_POLICY"
+	DRY_RUN_ENV_NAME               = "DRY_RUN"
+	ROOT_FS_DIR_ENV_NAME           = "ROOT_FS_DIR"
+	BACKUP_DIR_ENV_NAME            = "BACKUP_DIR"
+	JOURNAL_BACKUP_DIR_ENV_NAME    = "JOURNAL_BACKUP_DIR"
+	PLAN_FILE_ENV_NAME             = "PLAN_FILE"
+	JOURNAL_FILE_ENV_NAME          = "JOURNAL_FILE"
+	FILES_TO_SEARCH_ENV_NAME       = "FILES_TO_SEARCH"
+	RUN_IMAGE_ENV_NAME             = "RUN_IMAGE"
+	RUN_DIR_ENV_NAME               = "RUN_DIR"
+	PHASE_ENV_NAME                 = "PHASE"
+	EXTENSION_IDS_ENV_NAME         = "EXTENSION_IDS"
+	EXCLUDE_EXTENSION_IDS_ENV_NAME = "EXCLUDE_EXTENSION_IDS"
+	CHAINED_ENV_NAME               = "CHAINED"
+	EXTENSION_LAYERS_FILE_ENV_NAME = "EXTENSION_LAYERS_FILE"
+	LENIENT_ENV_NAME               = "LENIENT"
+	DOCKERFILE_LINT_ENV_NAME       = "DOCKERFILE_LINT"
+	RENDER_DOCKERFILES_ENV_NAME    = "RENDER_DOCKERFILES"
+	ARGS_REPORT_FILE_ENV_NAME      = "ARGS_REPORT_FILE"
+	ARG_ENV_PREFIXES_ENV_NAME      = "ARG_ENV_PREFIXES"
+	ARGS_FILE_ENV_NAME             = "ARGS_FILE"
+	CONFIG_FILE_ENV_NAME           = "CONFIG_FILE"
+	GRAPH_DRIVER_ENV_NAME          = "GRAPH_DRIVER"
+	STORAGE_ROOT_PATH_ENV_NAME     = "STORAGE_ROOT_PATH"
+	STORAGE_RUN_ROOT_PATH_ENV_NAME = "STORAGE_RUN_ROOT_PATH"
+	IGNORE_PATHS_ENV_NAME          = "IGNORE_PATHS"
+	KANIKO_DIR_ENV_NAME            = "KANIKO_DIR"
+
+	DefaultLevel          = "info"
+	DefaultLogFormat      = logging.FormatText
+	DefaultWorkspaceDir   = "/workspace"
+	DefaultCacheDir       = "/cache"
+	DefaultRootFSDir      = "/"
+	DefaultDockerfileName = "Dockerfile"
+	DefaultGraphDriver    = "vfs"
+	DefaultKanikoDir      = "/kaniko"
+
+	DefaultStorageRootDir    = "/var/lib/containers/storage"
+	DefaultStorageRunRootDir = "/var/run/containers/storage"
+
+	layersDirName           = "layers"
+	backupDirName           = "backup"
+	planFileName            = "plan.json"
+	journalFileName         = "journal.json"
+	journalBackupDirName    = "journal"
+	runDirName              = "run"
+	extensionLayersFileName = "extension-layers.json"
+	argsReportFileName      = "args-report.json"
+)
+
+// Source tells where the value of a setting comes from
+type Source string
+
+const (
+	SourceFlag    Source = "flag"
+	SourceEnv     Source = "env"
+	SourceFile    Source = "config file"
+	SourceDefault Source = "default"
+)
+
+// Value is the effective value of a setting
+type Value struct {
+	Value  string
+	Source Source
+	Name   string // Env var the value has been read from when it is not the one of the setting, e.g. DOCKER_FILE_NAME
+}
+
+// Lookup returns the value of a setting by env var name and where it comes from. An empty value is not defined
+type Lookup func(name string) (string, Source)
+
+// Config are the settings of the extension of the images, whatever the engine building the Dockerfiles
+type Config struct {
+	Engine              string                 // Name of the engine building the Dockerfiles. Default is the only one of the binary
+	LogLevel            string                 // Log level (trace, debug, info, warn, error, fatal, panic)
+	LogFormat           string                 // Log format (text, color, json)
+	LogTimestamp        bool                   // Timestamp in log output
+	WorkspaceDir        string                 // Dir of the Dockerfiles and of their build context
+	CacheDir            string                 // Dir where the images and the reports are stored
+	LayersDir           string                 // Dir of the metadata file, of the group file and of the generated Dockerfiles
+	GroupFile           string                 // Group file of the layers dir listing the extensions
+	MetadataFile        string                 // Metadata file listing the Dockerfiles and their args, relative to the layers dir
+	DockerfileName      string                 // Dockerfile of the workspace dir built when there is no metadata nor group file
+	ExtractLayers       bool                   // Extract the new layers to the root FS dir. Default is false
+	PreserveAttributes  bool                   // Apply the owner, mode, times and xattrs of the layer entries. Default is false
+	RemapIDs            bool                   // Map the uid/gid of the layer entries using the subid files. Default is false
+	OverwritePolicy     layer.OverwritePolicy  // Policy applied when a file of a layer already exists. Default is overwrite
+	DryRun              bool                   // Report the changes of the layers on the root FS without extracting them. Default is false
+	RootFSDir           string                 // Dir where the layers are extracted
+	BackupDir           string                 // Dir where the existing files are moved when the overwrite policy is backup
+	PlanFile            string                 // File where the extraction plan is stored in dry-run mode
+	JournalFile         string                 // File where the changes of the extraction are recorded to roll them back
+	JournalBackupDir    string                 // Dir where the paths removed during an extraction are kept. Default is next to the journal
+	FilesToSearch       []string               // List of files to search to check if they exist under the updated FS
+	RunImage            string                 // Run image used as base_image by the run Dockerfiles when their run args do not define it
+	RunDir              string                 // Dir where the extended run images are stored
+	Filter              model.DockerfileFilter // Phase and extension IDs of the Dockerfiles to be built. Default is all
+	Chained             bool                   // Build each Dockerfile on top of the image produced by the previous one. Default is false
+	ExtensionLayersFile string                 // JSON file listing, in order, the layers of the chained extensions
+	Lenient             bool                   // Build even if the metadata file has unknown keys, missing paths or duplicate args. Default is false
+	LintLevel           model.LintLevel        // Strictness of the lint of the extension Dockerfiles: off, warn, error. Default is warn
+	RenderDockerfiles   bool                   // Log the Dockerfiles once their args have been substituted by the args command. Default is false
+	ArgsReportFile      string                 // JSON file where the args command stores its report
+	ArgEnvPrefixes      []string               // Prefixes of the env vars passed as build args. Default is CNB_
+	ArgsFile            string                 // TOML file of build args passed to all the Dockerfiles, relative to the layers dir
+	GraphDriver         string                 // Graph driver of the storage of the buildah engine
+	StorageRootDir      string                 // Root dir of the storage of the buildah engine
+	StorageRunRootDir   string                 // Run root dir of the storage of the buildah engine
+	IgnorePaths         []string               // Paths ignored by the snapshots of the kaniko engine and by the search of the files
+	KanikoDir           string                 // Dir where the kaniko engine stores its snapshots and stages
+	File                string                 // Config file read, if any
+	Values              map[string]Value       // Effective value of the settings by env var name, and where it comes from
+}
+
+// FromEnv reads the config from the env vars and from the config file defined by the CONFIG_FILE env var. The paths
+// which are not defined are derived from the workspace and cache dirs
+func FromEnv() (*Config, error) {
+	return load(nil)
+}
+
+// load reads the config from the flags which have been given, then from the env vars, then from the config file
+func load(flags map[string]string) (*Config, error) {
+	lookup := func(name string) (string, Source) {
+		if v := flags[FlagName(name)]; v != "" {
+			return v, SourceFlag
+		}
+		if v := os.Getenv(name); v != "" {
+			return v, SourceEnv
+		}
+		return "", ""
+	}
+	configFile, _ := lookup(CONFIG_FILE_ENV_NAME)
+	if configFile == "" {
+		return Load(lookup)
+	}
+	values, err := ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Load(func(name string) (string, Source) {
+		if v, source := lookup(name); v != "" {
+			return v, source
+		}
+		if v, ok := values[name]; ok {
+			return v, SourceFile
+		}
+		return "", ""
+	})
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", configFile, err)
+	}
+	c.File = configFile
+	return c, nil
+}
+
+// Load reads the config from the values returned by lookup for the env var names, e.g. the flags or the env vars. The
+// effective value of each setting and where it comes from are recorded
+func Load(lookup Lookup) (*Config, error) {
+	c := &Config{Values: map[string]Value{}}
+	get := func(name string, defaultValue string) string {
+		v, source := lookup(name)
+		if v == "" {
+			v, source = defaultValue, SourceDefault
+		}
+		c.Values[name] = Value{Value: v, Source: source}
+		return v
+	}
+	list := func(name string, defaultValue []string) []string {
+		if v := get(name, strings.Join(defaultValue, ",")); v != "" {
+			return strings.Split(v, ",")
+		}
+		return nil
+	}
+
+	c.Engine = get(ENGINE_ENV_NAME, "")
+	c.LogLevel = get(LOGGING_LEVEL_ENV_NAME, DefaultLevel)
+	c.LogFormat = get(LOGGING_FORMAT_ENV_NAME, DefaultLogFormat)
+	c.WorkspaceDir = get(WORKSPACE_DIR_ENV_NAME, DefaultWorkspaceDir)
+	c.CacheDir = get(CACHE_DIR_ENV_NAME, DefaultCacheDir)
+	c.MetadataFile = get(METADATA_FILE_NAME_ENV_NAME, "")
+	c.RootFSDir = get(ROOT_FS_DIR_ENV_NAME, DefaultRootFSDir)
+	c.RunImage = get(RUN_IMAGE_ENV_NAME, "")
+	c.ArgsFile = get(ARGS_FILE_ENV_NAME, "")
+	c.GraphDriver = get(GRAPH_DRIVER_ENV_NAME, DefaultGraphDriver)
+	c.StorageRootDir = get(STORAGE_ROOT_PATH_ENV_NAME, DefaultStorageRootDir)
+	c.StorageRunRootDir = get(STORAGE_RUN_ROOT_PATH_ENV_NAME, DefaultStorageRunRootDir)
+	// DOCKER_FILE_NAME is the name used by the first version of the kaniko application
+	c.DockerfileName = get(DOCKERFILE_NAME_ENV_NAME, "")
+	if c.DockerfileName == "" {
+		c.DockerfileName = get(DOCKER_FILE_NAME_ENV_NAME, DefaultDockerfileName)
+		value := c.Values[DOCKER_FILE_NAME_ENV_NAME]
+		if value.Source != SourceDefault {
+			value.Name = DOCKER_FILE_NAME_ENV_NAME
+		}
+		c.Values[DOCKERFILE_NAME_ENV_NAME] = value
+	}
+	c.LayersDir = get(LAYERS_DIR_ENV_NAME, filepath.Join(c.WorkspaceDir, layersDirName))
+	c.GroupFile = c.LayersFile(get(GROUP_FILE_ENV_NAME, model.GroupFileName))
+	c.BackupDir = get(BACKUP_DIR_ENV_NAME, filepath.Join(c.CacheDir, backupDirName))
+	c.PlanFile = get(PLAN_FILE_ENV_NAME, filepath.Join(c.CacheDir, planFileName))
+	c.JournalFile = get(JOURNAL_FILE_ENV_NAME, filepath.Join(c.CacheDir, journalFileName))
+	c.JournalBackupDir = get(JOURNAL_BACKUP_DIR_ENV_NAME, filepath.Join(filepath.Dir(c.JournalFile), journalBackupDirName))
+	c.RunDir = get(RUN_DIR_ENV_NAME, filepath.Join(c.CacheDir, runDirName))
+	c.ExtensionLayersFile = get(EXTENSION_LAYERS_FILE_ENV_NAME, filepath.Join(c.CacheDir, extensionLayersFileName))
+	c.ArgsReportFile = get(ARGS_REPORT_FILE_ENV_NAME, filepath.Join(c.CacheDir, argsReportFileName))
+	c.FilesToSearch = list(FILES_TO_SEARCH_ENV_NAME, nil)
+	c.Filter.Include = list(EXTENSION_IDS_ENV_NAME, nil)
+	c.Filter.Exclude = list(EXCLUDE_EXTENSION_IDS_ENV_NAME, nil)
+	c.ArgEnvPrefixes = list(ARG_ENV_PREFIXES_ENV_NAME, model.DefaultArgEnvPrefixes)
+	c.IgnorePaths = list(IGNORE_PATHS_ENV_NAME, nil)
+	c.KanikoDir = get(KANIKO_DIR_ENV_NAME, DefaultKanikoDir)
+
+	for name, b := range map[string]*bool{
+		LOGGING_TIMESTAMP_ENV_NAME:   &c.LogTimestamp,
+		EXTRACT_LAYERS_ENV_NAME:      &c.ExtractLayers,
+		PRESERVE_ATTRIBUTES_ENV_NAME: &c.PreserveAttributes,
+		REMAP_IDS_ENV_NAME:           &c.RemapIDs,
+		DRY_RUN_ENV_NAME:             &c.DryRun,
+		CHAINED_ENV_NAME:             &c.Chained,
+		LENIENT_ENV_NAME:             &c.Lenient,
+		RENDER_DOCKERFILES_ENV_NAME:  &c.RenderDockerfiles,
+	} {
+		if err := c.parseBool(name, get(name, "false"), b); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if c.OverwritePolicy, err = layer.ParseOverwritePolicy(get(OVERWRITE_POLICY_ENV_NAME, string(layer.OverwritePolicyOverwrite))); err != nil {
+		return nil, c.settingError(OVERWRITE_POLICY_ENV_NAME, err)
+	}
+	if c.Filter.Phase, err = model.ParsePhase(get(PHASE_ENV_NAME, string(model.PhaseAll))); err != nil {
+		return nil, c.settingError(PHASE_ENV_NAME, err)
+	}
+	if c.LintLevel, err = model.ParseLintLevel(get(DOCKERFILE_LINT_ENV_NAME, string(model.LintWarn))); err != nil {
+		return nil, c.settingError(DOCKERFILE_LINT_ENV_NAME, err)
+	}
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		return nil, c.settingError(LOGGING_LEVEL_ENV_NAME, err)
+	}
+	switch c.LogFormat {
+	case logging.FormatText, logging.FormatColor, logging.FormatJSON:
+	default:
+		return nil, c.settingError(LOGGING_FORMAT_ENV_NAME, fmt.Errorf("unknown log format %q, expected one of: %s, %s, %s", c.LogFormat, logging.FormatText, logging.FormatColor, logging.FormatJSON))
+	}
+	return c, nil
+}
+
+// LayersFile resolves the path of a file of the layers dir, e.g. the metadata file. An absolute path is kept as is
+func (c *Config) LayersFile(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(c.LayersDir, name)
+}
+
+func (c *Config) parseBool(name string, v string, b *bool) error {
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return c.settingError(name, err)
+	}
+	*b = parsed
+	// The value is recorded as true or false whatever its syntax, e.g. 1
+	value := c.Values[name]
+	value.Value = strconv.FormatBool(parsed)
+	c.Values[name] = value
+	return nil
+}
+
+// settingError tells which setting is invalid and where its value comes from
+func (c *Config) settingError(name string, err error) error {
+	return fmt.Errorf("%s (%s): %w", name, c.Values[name].Source, err)
+}
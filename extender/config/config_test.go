@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/layer"
+)
+
+func setEnv(t *testing.T, env map[string]string) {
+	for name, value := range env {
+		name := name
+		old, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(name, old)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	setEnv(t, map[string]string{
+		WORKSPACE_DIR_ENV_NAME:    "/ws",
+		CACHE_DIR_ENV_NAME:        "/tmp/cache",
+		GROUP_FILE_ENV_NAME:       "my-group.toml",
+		DOCKER_FILE_NAME_ENV_NAME: "alpine",
+		EXTRACT_LAYERS_ENV_NAME:   "true",
+		OVERWRITE_POLICY_ENV_NAME: "backup",
+		PHASE_ENV_NAME:            "run",
+	})
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for got, want := range map[string]string{
+		c.LayersDir:        "/ws/layers",
+		c.GroupFile:        "/ws/layers/my-group.toml",
+		c.JournalFile:      "/tmp/cache/journal.json",
+		c.JournalBackupDir: "/tmp/cache/journal",
+		c.KanikoDir:        DefaultKanikoDir,
+		c.RunDir:           "/tmp/cache/run",
+		c.ArgsReportFile:   "/tmp/cache/args-report.json",
+		c.DockerfileName:   "alpine",
+		c.RootFSDir:        DefaultRootFSDir,
+	} {
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+	if !c.ExtractLayers || c.DryRun || c.OverwritePolicy != layer.OverwritePolicyBackup || c.Filter.Phase != model.PhaseRun {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if c.LintLevel != model.LintWarn {
+		t.Errorf("expected the default lint level, got %s", c.LintLevel)
+	}
+
+	// The value of the legacy env var is reported as read from it
+	if v := c.Values[DOCKERFILE_NAME_ENV_NAME]; v.Source != SourceEnv || v.Name != DOCKER_FILE_NAME_ENV_NAME {
+		t.Errorf("unexpected source of the Dockerfile name %+v", v)
+	}
+	var buf bytes.Buffer
+	c.Print(&buf)
+	if !strings.Contains(buf.String(), `dockerfile_name = "alpine" # env DOCKER_FILE_NAME`) {
+		t.Errorf("unexpected config view\n%s", buf.String())
+	}
+}
+
+func TestFromEnvInvalid(t *testing.T) {
+	setEnv(t, map[string]string{DRY_RUN_ENV_NAME: "maybe"})
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an invalid bool")
+	}
+}
+
+func TestFromFlags(t *testing.T) {
+	setEnv(t, map[string]string{
+		WORKSPACE_DIR_ENV_NAME: "/ws",
+		CACHE_DIR_ENV_NAME:     "/env/cache",
+		DRY_RUN_ENV_NAME:       "true",
+	})
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	AddFlags(fs, CACHE_DIR_ENV_NAME, DRY_RUN_ENV_NAME, EXTRACT_LAYERS_ENV_NAME, WORKSPACE_DIR_ENV_NAME)
+	if err := fs.Parse([]string{"--cache-dir", "/flag/cache", "--dry-run=false", "--extract-layers"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := FromFlags(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The flags have the precedence over the env vars, which have the precedence over the defaults
+	if c.CacheDir != "/flag/cache" || c.JournalFile != "/flag/cache/journal.json" || c.WorkspaceDir != "/ws" || c.RootFSDir != DefaultRootFSDir {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if c.DryRun || !c.ExtractLayers {
+		t.Errorf("unexpected bool flags, dry run: %v, extract layers: %v", c.DryRun, c.ExtractLayers)
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+version = 1
+engine = "buildah"
+
+[paths]
+workspace_dir = "/file/ws"
+cache_dir = "/file/cache"
+
+[storage]
+graph_driver = "overlay"
+
+[build]
+ignore_paths = ["/usr/lib", "/var/cache"]
+kaniko_dir = "/file/kaniko"
+
+[extract]
+dry_run = true
+overwrite_policy = "skip"
+
+[output]
+journal_backup_dir = "/file/journal-backup"
+`)
+	setEnv(t, map[string]string{
+		CONFIG_FILE_ENV_NAME: path,
+		CACHE_DIR_ENV_NAME:   "/env/cache",
+	})
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The env vars have the precedence over the config file
+	if c.Engine != "buildah" || c.WorkspaceDir != "/file/ws" || c.CacheDir != "/env/cache" || c.PlanFile != "/env/cache/plan.json" || c.GraphDriver != "overlay" {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if c.KanikoDir != "/file/kaniko" || c.JournalBackupDir != "/file/journal-backup" {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if !c.DryRun || c.OverwritePolicy != layer.OverwritePolicySkip || !reflect.DeepEqual(c.IgnorePaths, []string{"/usr/lib", "/var/cache"}) {
+		t.Errorf("unexpected extraction config %+v", c)
+	}
+	for name, want := range map[string]Value{
+		WORKSPACE_DIR_ENV_NAME: {Value: "/file/ws", Source: SourceFile},
+		CACHE_DIR_ENV_NAME:     {Value: "/env/cache", Source: SourceEnv},
+		ROOT_FS_DIR_ENV_NAME:   {Value: DefaultRootFSDir, Source: SourceDefault},
+	} {
+		if got := c.Values[name]; got != want {
+			t.Errorf("%s: got %+v, want %+v", name, got, want)
+		}
+	}
+
+	// The effective config can be used as config file
+	var buf bytes.Buffer
+	c.Print(&buf)
+	values, err := ReadFile(writeConfigFile(t, buf.String()))
+	if err != nil {
+		t.Fatalf("%s\n%s", err, buf.String())
+	}
+	if values[CACHE_DIR_ENV_NAME] != "/env/cache" || values[DRY_RUN_ENV_NAME] != "true" || values[IGNORE_PATHS_ENV_NAME] != "/usr/lib,/var/cache" {
+		t.Errorf("unexpected values %v", values)
+	}
+}
+
+func TestConfigFileInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"no version":      `engine = "kaniko"`,
+		"unknown version": "version = 2",
+		"unknown key":     "version = 1\n[paths]\nworkspace = \"/ws\"",
+		"wrong type":      "version = 1\n[extract]\ndry_run = \"yes\"",
+		"invalid value":   "version = 1\n[extract]\noverwrite_policy = \"nope\"",
+		"invalid level":   "version = 1\n[logging]\nlevel = \"verbose\"",
+	} {
+		setEnv(t, map[string]string{CONFIG_FILE_ENV_NAME: writeConfigFile(t, content)})
+		if _, err := FromEnv(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// FileVersion is the version of the format of the config file
+const FileVersion = 1
+
+const versionKey = "version"
+
+// ReadFile reads the settings of a TOML config file by env var name. The version of the file must be supported, the
+// tables and the keys must be known and the values must have the type of the setting: bool, array of strings or string.
+// The values themselves are validated once merged with the flags and the env vars
+func ReadFile(path string) (map[string]string, error) {
+	var content map[string]interface{}
+	if _, err := toml.DecodeFile(path, &content); err != nil {
+		return nil, fmt.Errorf("config file %s cannot be decoded: %w", path, err)
+	}
+	version, ok := content[versionKey].(int64)
+	if !ok || version != FileVersion {
+		return nil, fmt.Errorf("config file %s: unsupported version %v, expected %s = %d", path, content[versionKey], versionKey, FileVersion)
+	}
+	delete(content, versionKey)
+
+	values := map[string]string{}
+	var problems []string
+	for key, v := range flatten("", content) {
+		s, ok := settingOfKey(key)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown key %s", key))
+			continue
+		}
+		value, err := s.fileValue(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", key, err))
+			continue
+		}
+		values[s.EnvName] = value
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("config file %s: %s", path, strings.Join(problems, ", "))
+	}
+	return values, nil
+}
+
+// flatten returns the values of the tables by key prefixed by their table, e.g. extract.dry_run
+func flatten(prefix string, table map[string]interface{}) map[string]interface{} {
+	values := map[string]interface{}{}
+	for k, v := range table {
+		key := prefix + k
+		if t, ok := v.(map[string]interface{}); ok {
+			for tk, tv := range flatten(key+".", t) {
+				values[tk] = tv
+			}
+			continue
+		}
+		values[key] = v
+	}
+	return values
+}
+
+func settingOfKey(key string) (Setting, bool) {
+	for _, s := range Settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// fileValue converts the value of the config file to the value of the env var of the setting
+func (s Setting) fileValue(v interface{}) (string, error) {
+	switch {
+	case s.Bool:
+		if b, ok := v.(bool); ok {
+			return strconv.FormatBool(b), nil
+		}
+		return "", fmt.Errorf("expected a bool, got %v", v)
+	case s.List:
+		items, ok := v.([]interface{})
+		if !ok {
+			return "", fmt.Errorf("expected an array of strings, got %v", v)
+		}
+		var values []string
+		for _, item := range items {
+			value, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("expected an array of strings, got %v", v)
+			}
+			values = append(values, value)
+		}
+		return strings.Join(values, ","), nil
+	}
+	if value, ok := v.(string); ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("expected a string, got %v", v)
+}
+
+// Print writes the effective config as a TOML config file. Each value is commented with where it comes from
+func (c *Config) Print(w io.Writer) {
+	if c.File != "" {
+		fmt.Fprintf(w, "# Config file: %s\n", c.File)
+	}
+	fmt.Fprintf(w, "%s = %d\n", versionKey, FileVersion)
+	table := ""
+	for _, s := range Settings {
+		if s.Key == "" {
+			continue
+		}
+		key := s.Key
+		if i := strings.Index(key, "."); i > 0 {
+			if key[:i] != table {
+				table = key[:i]
+				fmt.Fprintf(w, "\n[%s]\n", table)
+			}
+			key = key[i+1:]
+		}
+		v := c.Values[s.EnvName]
+		source := string(v.Source)
+		if v.Source == SourceFlag {
+			source = fmt.Sprintf("%s --%s", v.Source, FlagName(s.EnvName))
+		} else if v.Source == SourceEnv && v.Name != "" {
+			source = fmt.Sprintf("%s %s", v.Source, v.Name)
+		} else if v.Source == SourceEnv {
+			source = fmt.Sprintf("%s %s", v.Source, s.EnvName)
+		}
+		fmt.Fprintf(w, "%s = %s # %s\n", key, s.tomlValue(v.Value), source)
+	}
+}
+
+// tomlValue formats the value of the setting as a TOML value
+func (s Setting) tomlValue(v string) string {
+	switch {
+	case s.Bool:
+		return v
+	case s.List:
+		var items []string
+		if v != "" {
+			for _, item := range strings.Split(v, ",") {
+				items = append(items, strconv.Quote(item))
+			}
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return strconv.Quote(v)
+}
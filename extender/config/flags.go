@@ -0,0 +1,120 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// Setting is a setting of the config which can be defined by a flag, an env var or a key of the config file, e.g.
+// --dry-run, DRY_RUN and dry_run of the extract table. The flag has the precedence over the env var, which has the
+// precedence over the config file, which has the precedence over the default value
+type Setting struct {
+	EnvName string
+	Key     string // Key of the config file, prefixed by its table. The setting is not part of the file when empty
+	Usage   string
+	Bool    bool // The flag can be given without value, e.g. --dry-run
+	List    bool // Comma separated list, or array of the config file
+}
+
+// Settings are the settings which can be defined by a flag. They are ordered by table of the config file
+var Settings = []Setting{
+	{EnvName: CONFIG_FILE_ENV_NAME, Usage: "TOML config file of the settings which are not defined by a flag nor an env var"},
+	{EnvName: ENGINE_ENV_NAME, Key: "engine", Usage: "Engine building the Dockerfiles. Default is the engine of the application"},
+	{EnvName: LOGGING_LEVEL_ENV_NAME, Key: "logging.level", Usage: "Log level: trace, debug, info, warn, error, fatal, panic. Default is info"},
+	{EnvName: LOGGING_FORMAT_ENV_NAME, Key: "logging.format", Usage: "Logging format: text, color, json. Default is text"},
+	{EnvName: LOGGING_TIMESTAMP_ENV_NAME, Key: "logging.timestamp", Usage: "Timestamp in log output", Bool: true},
+	{EnvName: WORKSPACE_DIR_ENV_NAME, Key: "paths.workspace_dir", Usage: "Dir containing the Dockerfiles and the layers dir. Default is /workspace"},
+	{EnvName: CACHE_DIR_ENV_NAME, Key: "paths.cache_dir", Usage: "Dir where the images, plans, journals and reports are stored. Default is /cache"},
+	{EnvName: LAYERS_DIR_ENV_NAME, Key: "paths.layers_dir", Usage: "Dir of the metadata file, of the group file and of the generated Dockerfiles. Default is <workspace-dir>/layers"},
+	{EnvName: ROOT_FS_DIR_ENV_NAME, Key: "paths.root_fs_dir", Usage: "Dir where the layers are extracted. Default is /"},
+	{EnvName: GROUP_FILE_ENV_NAME, Key: "paths.group_file", Usage: "Group file listing the extensions of the layers dir. Default is group.toml"},
+	{EnvName: METADATA_FILE_NAME_ENV_NAME, Key: "paths.metadata_file", Usage: "Metadata file listing the Dockerfiles, relative to the layers dir"},
+	{EnvName: DOCKERFILE_NAME_ENV_NAME, Key: "paths.dockerfile_name", Usage: "Dockerfile of the workspace dir built when there is no metadata nor group file. Default is Dockerfile"},
+	{EnvName: ARGS_FILE_ENV_NAME, Key: "paths.args_file", Usage: "TOML file of args passed to all the Dockerfiles, relative to the layers dir"},
+	{EnvName: GRAPH_DRIVER_ENV_NAME, Key: "storage.graph_driver", Usage: "Graph driver of the storage of the buildah engine. Default is vfs"},
+	{EnvName: STORAGE_ROOT_PATH_ENV_NAME, Key: "storage.root", Usage: "Root dir of the storage of the buildah engine. Default is /var/lib/containers/storage"},
+	{EnvName: STORAGE_RUN_ROOT_PATH_ENV_NAME, Key: "storage.run_root", Usage: "Run root dir of the storage of the buildah engine. Default is /var/run/containers/storage"},
+	{EnvName: PHASE_ENV_NAME, Key: "build.phase", Usage: "Phase of the Dockerfiles to be built: build, run, all. Default is all"},
+	{EnvName: EXTENSION_IDS_ENV_NAME, Key: "build.extension_ids", Usage: "Comma separated list of the extensions to be built", List: true},
+	{EnvName: EXCLUDE_EXTENSION_IDS_ENV_NAME, Key: "build.exclude_extension_ids", Usage: "Comma separated list of the extensions to be skipped", List: true},
+	{EnvName: CHAINED_ENV_NAME, Key: "build.chained", Usage: "Build each Dockerfile on top of the image produced by the previous one", Bool: true},
+	{EnvName: RUN_IMAGE_ENV_NAME, Key: "build.run_image", Usage: "Image used as base_image by the run Dockerfiles"},
+	{EnvName: LENIENT_ENV_NAME, Key: "build.lenient", Usage: "Build even if problems are found in the metadata file", Bool: true},
+	{EnvName: DOCKERFILE_LINT_ENV_NAME, Key: "build.dockerfile_lint", Usage: "Strictness of the lint of the extension Dockerfiles: off, warn, error. Default is warn"},
+	{EnvName: ARG_ENV_PREFIXES_ENV_NAME, Key: "build.arg_env_prefixes", Usage: "Comma separated prefixes of the env vars passed as args to the Dockerfiles. Default is CNB_", List: true},
+	{EnvName: IGNORE_PATHS_ENV_NAME, Key: "build.ignore_paths", Usage: "Comma separated paths ignored by the snapshots of the kaniko engine and by the search of the files", List: true},
+	{EnvName: KANIKO_DIR_ENV_NAME, Key: "build.kaniko_dir", Usage: "Dir where the kaniko engine stores its snapshots and stages. Default is /kaniko"},
+	{EnvName: EXTRACT_LAYERS_ENV_NAME, Key: "extract.enabled", Usage: "Extract the new layers to the root FS dir", Bool: true},
+	{EnvName: PRESERVE_ATTRIBUTES_ENV_NAME, Key: "extract.preserve_attributes", Usage: "Apply the owner, mode bits, times and xattrs of the layer entries", Bool: true},
+	{EnvName: REMAP_IDS_ENV_NAME, Key: "extract.remap_ids", Usage: "Map the uid/gid of the layer entries using the /etc/subuid and /etc/subgid files", Bool: true},
+	{EnvName: OVERWRITE_POLICY_ENV_NAME, Key: "extract.overwrite_policy", Usage: "Policy applied when a file of a layer already exists: overwrite, skip, fail, backup. Default is overwrite"},
+	{EnvName: DRY_RUN_ENV_NAME, Key: "extract.dry_run", Usage: "Report the changes of the layers on the root FS without extracting them", Bool: true},
+	{EnvName: FILES_TO_SEARCH_ENV_NAME, Key: "extract.files_to_search", Usage: "Comma separated list of files searched under the root FS dir once the layers are extracted", List: true},
+	{EnvName: BACKUP_DIR_ENV_NAME, Key: "output.backup_dir", Usage: "Dir where the existing files are moved when the policy is backup. Default is <cache-dir>/backup"},
+	{EnvName: PLAN_FILE_ENV_NAME, Key: "output.plan_file", Usage: "JSON file where the changes are stored in dry-run mode. Default is <cache-dir>/plan.json"},
+	{EnvName: JOURNAL_FILE_ENV_NAME, Key: "output.journal_file", Usage: "File where the changes of the extraction are recorded. Default is <cache-dir>/journal.json"},
+	{EnvName: JOURNAL_BACKUP_DIR_ENV_NAME, Key: "output.journal_backup_dir", Usage: "Dir where the paths removed by the extraction are moved. Default is the journal dir next to the journal file"},
+	{EnvName: RUN_DIR_ENV_NAME, Key: "output.run_dir", Usage: "Dir where the extended run images are stored. Default is <cache-dir>/run"},
+	{EnvName: EXTENSION_LAYERS_FILE_ENV_NAME, Key: "output.extension_layers_file", Usage: "JSON file listing the layers of the chained extensions. Default is <cache-dir>/extension-layers.json"},
+	{EnvName: ARGS_REPORT_FILE_ENV_NAME, Key: "output.args_report_file", Usage: "JSON file where the args report is stored. Default is <cache-dir>/args-report.json"},
+	{EnvName: RENDER_DOCKERFILES_ENV_NAME, Key: "output.render_dockerfiles", Usage: "Log the Dockerfiles once their args have been substituted", Bool: true},
+}
+
+// FlagName returns the name of the flag mirroring an env var, e.g. dry-run for DRY_RUN
+func FlagName(envName string) string {
+	return strings.ReplaceAll(strings.ToLower(envName), "_", "-")
+}
+
+// AddFlags defines the flags mirroring the env vars of the settings in the flag set
+func AddFlags(fs *flag.FlagSet, envNames ...string) {
+	for _, name := range envNames {
+		s, ok := setting(name)
+		if !ok {
+			panic(fmt.Sprintf("no setting for the env var %s", name))
+		}
+		usage := fmt.Sprintf("%s (env %s)", s.Usage, name)
+		if s.Key != "" {
+			usage = fmt.Sprintf("%s (env %s, config file key %s)", s.Usage, name, s.Key)
+		}
+		fs.Var(&settingValue{bool: s.Bool}, FlagName(name), usage)
+	}
+}
+
+// FromFlags reads the config from the flags of the flag set which have been given, then from the env vars, then from
+// the config file
+func FromFlags(fs *flag.FlagSet) (*Config, error) {
+	given := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = f.Value.String()
+	})
+	return load(given)
+}
+
+func setting(envName string) (Setting, bool) {
+	for _, s := range Settings {
+		if s.EnvName == envName {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// settingValue is the value of a flag. A bool flag given without value is true
+type settingValue struct {
+	value string
+	bool  bool
+}
+
+func (v *settingValue) String() string {
+	return v.value
+}
+
+func (v *settingValue) Set(s string) error {
+	v.value = s
+	return nil
+}
+
+func (v *settingValue) IsBoolFlag() bool {
+	return v.bool
+}
@@ -0,0 +1,81 @@
+// Package engine defines the interface of the engines building the Dockerfiles of the extensions, e.g. kaniko or
+// buildah. The phases, the extraction of the layers and the reports are handled by the app package whatever the engine.
+// The engines are registered by name and the one building the Dockerfiles is selected at runtime by the ENGINE setting
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redhat-buildpacks/poc/extender/config"
+	"github.com/redhat-buildpacks/poc/extender/extract"
+	"github.com/redhat-buildpacks/poc/extender/model"
+)
+
+// Engine builds the Dockerfiles
+type Engine interface {
+	// Name returns the name of the engine, e.g. kaniko
+	Name() string
+	// ParseDockerfile parses the instructions of a Dockerfile using the parser of the engine
+	ParseDockerfile(path string) ([]model.Instruction, error)
+	// Build builds a Dockerfile with its args and returns the image produced with its new layers
+	Build(req Request) (Image, error)
+}
+
+// Request is the build of a Dockerfile
+type Request struct {
+	Phase      model.Phase
+	Dockerfile string              // Path of the Dockerfile
+	ContextDir string              // Build context dir of the Dockerfile
+	Args       []model.ResolvedArg // Args passed to the Dockerfile, including base_image
+	Secrets    []model.Secret      // Secrets mounted for the RUN instructions of the Dockerfile
+	Layout     string              // Dir where the image is stored as an OCI layout. The image is not stored when empty
+}
+
+// Image is an image built by an engine
+type Image struct {
+	Reference string          // Reference of the image, which can be passed as base_image to the next Dockerfile
+	Digest    string          // Digest of the manifest of the image stored as an OCI layout
+	Layers    []extract.Layer // Layers of the image which are not part of its base image, in order
+}
+
+// Factory creates an engine using the shared config. The settings specific to the engine are read by the factory
+type Factory func(c *config.Config) (Engine, error)
+
+var factories = map[string]Factory{}
+
+// Register makes an engine available under a name. The engines are registered by the main packages of the binaries,
+// each binary registering the engines whose dependencies it is built with
+func Register(name string, factory Factory) {
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("engine %s registered twice", name))
+	}
+	factories[name] = factory
+}
+
+// Names returns the sorted names of the registered engines
+func Names() []string {
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the engine having the name. When the name is empty, the engine is the only one registered
+func New(name string, c *config.Config) (Engine, error) {
+	names := Names()
+	if name == "" {
+		if len(names) != 1 {
+			return nil, fmt.Errorf("no engine selected, expected one of: %s", strings.Join(names, ", "))
+		}
+		name = names[0]
+	}
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown engine %q, this binary provides: %s", name, strings.Join(names, ", "))
+	}
+	return factory(c)
+}
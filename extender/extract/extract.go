@@ -0,0 +1,215 @@
+// Package extract applies the new layers of the images built by the engines to the root FS dir. The changes are
+// recorded in a journal in order to roll them back when an extraction fails or when the rollback command is executed
+package extract
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/layer"
+	"github.com/sirupsen/logrus"
+)
+
+// Layer is a new layer of an image built by an engine
+type Layer struct {
+	model.ExtendedLayer
+	Open func() (io.ReadCloser, error) // Opens the uncompressed tar stream of the layer
+}
+
+// Extractor applies the layers to the root FS dir
+type Extractor struct {
+	RootFSDir          string
+	Extract            bool
+	DryRun             bool
+	PreserveAttributes bool
+	IDMappings         *layer.IDMappings
+	OverwritePolicy    layer.OverwritePolicy
+	BackupDir          string
+	PlanFile           string
+	JournalFile        string
+	JournalBackupDir   string
+	Journal            *layer.Journal
+	Dockerfile         string // Dockerfile which has produced the layers applied, recorded in the plan
+
+	plan      *layer.Plan      // Changes planned, in dry-run mode, by all the layers applied during the run
+	planState *layer.PlanState // Root FS dir as left by the layers planned
+}
+
+// Apply applies, in order, the layers to the root FS dir. When a layer fails, the changes of all the layers are rolled
+// back, not only the ones of the layer which failed
+func (e *Extractor) Apply(layers []Layer) error {
+	var report layer.Report
+	plan := layer.NewPlan(e.RootFSDir)
+	if e.DryRun && e.plan == nil {
+		e.plan = layer.NewPlan(e.RootFSDir)
+		e.planState = layer.NewPlanState()
+	}
+	if e.Extract && !e.DryRun && e.Journal == nil {
+		if err := e.OpenJournal(); err != nil {
+			return err
+		}
+	}
+	for _, l := range layers {
+		// The extraction would have stopped at the first failure
+		if e.DryRun && e.plan.Failure != nil {
+			logrus.Warnf("Layer %s not planned as the extraction would fail on %s", l.Digest, e.plan.Failure.Path)
+			continue
+		}
+		logrus.Infof("Layer to be extracted %s", l.Digest)
+		r, err := e.apply(l)
+		if err != nil {
+			err = fmt.Errorf("layer %s: %w", l.Digest, err)
+			e.rollbackPending(err)
+			return err
+		}
+		if e.DryRun {
+			plan.Add(e.Dockerfile, l.Digest, r.Changes)
+			e.plan.Add(e.Dockerfile, l.Digest, r.Changes)
+		}
+		report.Merge(r)
+	}
+	if e.DryRun {
+		return e.writePlan(plan)
+	}
+	if e.Journal != nil {
+		if err := e.Journal.Commit(); err != nil {
+			return err
+		}
+	}
+	report.Log()
+	return nil
+}
+
+// apply applies the uncompressed content of the layer to the root FS dir
+func (e *Extractor) apply(l Layer) (layer.Report, error) {
+	rc, err := l.Open()
+	if err != nil {
+		return layer.Report{}, err
+	}
+	defer rc.Close()
+	return layer.NewApplier(e.RootFSDir, e.applierOptions()).Apply(rc)
+}
+
+// applierOptions returns the options used to apply the layers to the root FS dir
+func (e *Extractor) applierOptions() layer.Options {
+	return layer.Options{
+		Extract:            e.Extract,
+		DryRun:             e.DryRun,
+		PreserveAttributes: e.PreserveAttributes,
+		IDMappings:         e.IDMappings,
+		OverwritePolicy:    e.OverwritePolicy,
+		BackupDir:          e.BackupDir,
+		Journal:            e.Journal,
+		PlanState:          e.planState,
+	}
+}
+
+// writePlan outputs the changes planned in dry-run mode for the layers applied as a table. The plan of all the
+// layers applied during the run is stored as a JSON file
+func (e *Extractor) writePlan(plan *layer.Plan) error {
+	if err := layer.WritePlanTable(os.Stdout, plan); err != nil {
+		return err
+	}
+	if err := layer.WritePlanJSON(e.PlanFile, e.plan); err != nil {
+		return err
+	}
+	logrus.Infof("Extraction plan of %s stored at %s", e.RootFSDir, e.PlanFile)
+	return nil
+}
+
+// OpenJournal opens, or creates, the journal recording the changes of the extractions done by the application. The
+// changes of the previous runs are kept in order to roll them back too
+func (e *Extractor) OpenJournal() error {
+	journal, err := layer.NewJournal(e.JournalFile, e.JournalBackupDir)
+	if err != nil {
+		return fmt.Errorf("journal %s cannot be opened: %w", e.JournalFile, err)
+	}
+	e.Journal = journal
+	logrus.Debugf("Journal of the extraction stored at %s", e.JournalFile)
+	return nil
+}
+
+// RecoverJournal rolls back the changes not committed by an extraction which has been interrupted
+func (e *Extractor) RecoverJournal() error {
+	journal, err := layer.LoadJournal(e.JournalFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("journal %s cannot be loaded: %w", e.JournalFile, err)
+	}
+	defer journal.Close()
+	if !journal.Pending() {
+		return nil
+	}
+	logrus.Warnf("An extraction has been interrupted, rolling back its changes using the journal %s", e.JournalFile)
+	if err := journal.RollbackPending(); err != nil {
+		return fmt.Errorf("changes of the interrupted extraction cannot be rolled back: %w", err)
+	}
+	return nil
+}
+
+// Rollback undoes all the changes recorded in the journal by the last runs of the application, see layer.JournalRuns
+func (e *Extractor) Rollback() error {
+	journal, err := layer.LoadJournal(e.JournalFile)
+	if err != nil {
+		return fmt.Errorf("journal %s cannot be loaded: %w", e.JournalFile, err)
+	}
+	if err := journal.Rollback(); err != nil {
+		return err
+	}
+	logrus.Infof("Changes recorded in the journal %s rolled back", e.JournalFile)
+	return nil
+}
+
+// rollbackPending rolls back the changes of an extraction which failed
+func (e *Extractor) rollbackPending(err error) {
+	if e.Journal == nil {
+		return
+	}
+	logrus.Errorf("Extraction failed, rolling back its changes: %s", err.Error())
+	if err := e.Journal.RollbackPending(); err != nil {
+		logrus.Errorf("Rollback failed: %s", err.Error())
+	}
+}
+
+// OpenFile returns the opener of a layer stored in a file, e.g. a blob of an OCI layout. The file can be compressed
+// with gzip
+func OpenFile(path string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		br := bufio.NewReader(f)
+		if magic, err := br.Peek(2); err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+			return &readCloser{Reader: br, closers: []io.Closer{f}}, nil
+		}
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: gzr, closers: []io.Closer{gzr, f}}, nil
+	}
+}
+
+// readCloser closes the readers stacked on top of a file
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
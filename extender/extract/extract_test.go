@@ -0,0 +1,261 @@
+package extract
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/layer"
+	"github.com/redhat-buildpacks/poc/layer/layertest"
+)
+
+func TestApply(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "ca.crt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	layers := []Layer{
+		{Open: OpenFile(layertest.WriteLayer(t, base, true, []layertest.Entry{
+			{Name: "etc/ca.crt", Typeflag: tar.TypeReg, Body: "new"},
+			{Name: "usr/local/bin/tool", Typeflag: tar.TypeReg, Body: "tool"},
+		}))},
+		// The engines may also give the uncompressed content of the layers
+		{Open: OpenFile(layertest.WriteLayer(t, base, false, []layertest.Entry{{Name: "usr/local/bin/.wh.tool", Typeflag: tar.TypeReg}}))},
+	}
+	failing := Layer{Open: OpenFile(layertest.WriteLayer(t, base, true, []layertest.Entry{
+		{Name: "etc/ca.crt", Typeflag: tar.TypeReg, Body: "new"},
+		{Name: "../evil.txt", Typeflag: tar.TypeReg, Body: "evil"},
+	}))}
+
+	newExtractor := func() *Extractor {
+		return &Extractor{
+			Extract:          true,
+			RootFSDir:        root,
+			JournalFile:      filepath.Join(base, "journal.json"),
+			JournalBackupDir: filepath.Join(base, "journal"),
+		}
+	}
+	assertRolledBack := func(t *testing.T) {
+		if content, _ := os.ReadFile(filepath.Join(root, "etc", "ca.crt")); string(content) != "old" {
+			t.Errorf("etc/ca.crt not restored, got %q", content)
+		}
+		if _, err := os.Lstat(filepath.Join(root, "usr")); !os.IsNotExist(err) {
+			t.Errorf("usr has not been removed: %v", err)
+		}
+	}
+
+	t.Run("failed extraction", func(t *testing.T) {
+		if err := newExtractor().Apply([]Layer{layers[0], failing}); err == nil {
+			t.Fatal("expected the extraction to fail")
+		}
+		assertRolledBack(t)
+	})
+
+	t.Run("rollback command", func(t *testing.T) {
+		e := newExtractor()
+		if err := e.Apply(layers); err != nil {
+			t.Fatal(err)
+		}
+		e.Journal.Close()
+		if content, _ := os.ReadFile(filepath.Join(root, "etc", "ca.crt")); string(content) != "new" {
+			t.Fatalf("etc/ca.crt not extracted, got %q", content)
+		}
+		if _, err := os.Lstat(filepath.Join(root, "usr", "local", "bin", "tool")); !os.IsNotExist(err) {
+			t.Fatalf("usr/local/bin/tool should have been removed by the last layer: %v", err)
+		}
+		// A committed extraction is not rolled back when the application starts
+		if err := newExtractor().RecoverJournal(); err != nil {
+			t.Fatal(err)
+		}
+		if content, _ := os.ReadFile(filepath.Join(root, "etc", "ca.crt")); string(content) != "new" {
+			t.Fatalf("committed changes rolled back, got %q", content)
+		}
+		if err := newExtractor().Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		assertRolledBack(t)
+	})
+}
+
+func TestApplyDryRun(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	e := &Extractor{
+		DryRun:    true,
+		RootFSDir: root,
+		PlanFile:  filepath.Join(base, "plan.json"),
+	}
+	dockerfiles := map[string][]Layer{
+		"first/Dockerfile": {
+			{ExtendedLayer: model.ExtendedLayer{Digest: "sha256:1"}, Open: OpenFile(layertest.WriteLayer(t, base, true, []layertest.Entry{{Name: "tool", Typeflag: tar.TypeReg, Body: "v1"}}))},
+			{ExtendedLayer: model.ExtendedLayer{Digest: "sha256:2"}, Open: OpenFile(layertest.WriteLayer(t, base, true, []layertest.Entry{{Name: "tool", Typeflag: tar.TypeReg, Body: "v2"}}))},
+		},
+		"second/Dockerfile": {
+			{ExtendedLayer: model.ExtendedLayer{Digest: "sha256:3"}, Open: OpenFile(layertest.WriteLayer(t, base, true, []layertest.Entry{{Name: ".wh.tool", Typeflag: tar.TypeReg}}))},
+		},
+	}
+	for _, dockerfile := range []string{"first/Dockerfile", "second/Dockerfile"} {
+		e.Dockerfile = dockerfile
+		if err := e.Apply(dockerfiles[dockerfile]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The plan file contains the layers of all the Dockerfiles, each one planned after the previous ones
+	data, err := os.ReadFile(e.PlanFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan layer.Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		dockerfile string
+		layer      string
+		kind       layer.ChangeKind
+	}{
+		{"first/Dockerfile", "sha256:1", layer.ChangeAdded},
+		{"first/Dockerfile", "sha256:2", layer.ChangeModified},
+		{"second/Dockerfile", "sha256:3", layer.ChangeDeleted},
+	}
+	if len(plan.Layers) != len(expected) {
+		t.Fatalf("expected %d layers, got %+v", len(expected), plan.Layers)
+	}
+	for i, l := range plan.Layers {
+		if l.Dockerfile != expected[i].dockerfile || l.Layer != expected[i].layer || len(l.Changes) != 1 || l.Changes[0].Kind != expected[i].kind {
+			t.Errorf("expected %+v, got %+v", expected[i], l)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(root, "tool")); !os.IsNotExist(err) {
+		t.Errorf("tool has been extracted: %v", err)
+	}
+}
+
+func TestApplyDryRunFailure(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	e := &Extractor{
+		DryRun:          true,
+		RootFSDir:       root,
+		OverwritePolicy: layer.OverwritePolicyFail,
+		PlanFile:        filepath.Join(base, "plan.json"),
+	}
+	// The second layer overwrites the file of the first one, so the third one would not be extracted
+	var layers []Layer
+	for i, name := range []string{"tool", "tool", "other"} {
+		layers = append(layers, Layer{
+			ExtendedLayer: model.ExtendedLayer{Digest: fmt.Sprintf("sha256:%d", i+1)},
+			Open:          OpenFile(layertest.WriteLayer(t, base, false, []layertest.Entry{{Name: name, Typeflag: tar.TypeReg, Body: name}})),
+		})
+	}
+	if err := e.Apply(layers); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.plan.Layers) != 2 || e.plan.Failure == nil || e.plan.Failure.Path != filepath.Join(root, "tool") {
+		t.Errorf("unexpected plan %+v", e.plan)
+	}
+}
+
+func TestLayoutLayers(t *testing.T) {
+	dir := t.TempDir()
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The blobs are named after the digest of their name
+	digest := func(name string) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(name)))
+	}
+	blob := func(name string) string {
+		return filepath.Join(blobs, strings.TrimPrefix(digest(name), "sha256:"))
+	}
+	writeJSON := func(path string, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"base", "new"} {
+		if err := os.Rename(layertest.WriteLayer(t, dir, true, []layertest.Entry{{Name: name + ".txt", Typeflag: tar.TypeReg}}), blob(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeJSON(blob("manifest"), fmt.Sprintf(`{"layers": [{"digest": %q}, {"digest": %q, "size": 42}]}`, digest("base"), digest("new")))
+	writeJSON(filepath.Join(dir, "index.json"), fmt.Sprintf(`{"manifests": [{"digest": %q}]}`, digest("manifest")))
+
+	layers, err := LayoutLayers(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 2 || layers[0].Digest != digest("base") {
+		t.Fatalf("unexpected layers %+v", layers)
+	}
+	layers, err = LayoutLayers(dir, []string{digest("new")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 || layers[0].Size != 42 {
+		t.Fatalf("unexpected layers %+v", layers)
+	}
+	r, err := layers[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if hdr, err := tar.NewReader(r).Next(); err != nil || hdr.Name != "new.txt" {
+		t.Errorf("unexpected entry %v: %v", hdr, err)
+	}
+	if _, err := LayoutLayers(dir, []string{digest("unknown")}); err == nil {
+		t.Error("expected an error for a layer which is not part of the image")
+	}
+}
+
+func TestLayoutLayersInvalidDigests(t *testing.T) {
+	valid := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("manifest")))
+	tests := []struct {
+		name     string
+		index    string
+		manifest string
+	}{
+		{name: "index escaping the layout", index: "sha256:../../../etc/passwd"},
+		{name: "index with a path separator", index: "sha256:aa/../../bb"},
+		{name: "index without algorithm", index: "../index.json"},
+		{name: "index with a short sha256", index: "sha256:abcdef"},
+		{name: "manifest escaping the layout", index: valid, manifest: `{"layers": [{"digest": "sha256:../../../etc/passwd"}]}`},
+		{name: "manifest with an upper case digest", index: valid, manifest: `{"layers": [{"digest": "SHA256:ABCDEF"}]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "index.json"), []byte(fmt.Sprintf(`{"manifests": [{"digest": %q}]}`, test.index)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			manifest := filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(valid, "sha256:"))
+			if err := os.WriteFile(manifest, []byte(test.manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LayoutLayers(dir, nil); err == nil || !strings.Contains(err.Error(), "invalid") {
+				t.Errorf("expected an invalid digest error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/redhat-buildpacks/poc/extender/model"
+)
+
+// digestRegexp matches a digest made of an algorithm and of an hex encoded value, e.g. sha256:<hex>. The digests read
+// from an OCI layout are joined to the path of its blobs dir and must not contain a path separator or ..
+var digestRegexp = regexp.MustCompile(`^([a-z0-9]+(?:[+._-][a-z0-9]+)*):([a-f0-9]+)$`)
+
+// digestSizes is the length of the hex encoded value of the digests of the algorithms registered by the OCI image spec
+var digestSizes = map[string]int{"sha256": 64, "sha512": 128}
+
+// ociIndex and ociManifest are the parts of the index.json and of the manifest of an OCI layout which are needed to
+// find the layers of the image
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// LayoutLayers returns, in order, the layers of the image of an OCI layout dir, e.g. an extended run image. When
+// digests are given, only the layers having one of them are returned, e.g. the layers added by an extension
+func LayoutLayers(dir string, digests []string) ([]Layer, error) {
+	var index ociIndex
+	if err := readBlobJSON(filepath.Join(dir, "index.json"), &index); err != nil {
+		return nil, err
+	}
+	if len(index.Manifests) != 1 {
+		return nil, fmt.Errorf("OCI layout %s: expected one image, found %d", dir, len(index.Manifests))
+	}
+	manifestPath, err := BlobPath(dir, index.Manifests[0].Digest)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ociManifest
+	if err := readBlobJSON(manifestPath, &manifest); err != nil {
+		return nil, err
+	}
+
+	selected := map[string]bool{}
+	for _, d := range digests {
+		selected[d] = true
+	}
+	var layers []Layer
+	for _, l := range manifest.Layers {
+		if len(digests) > 0 && !selected[l.Digest] {
+			continue
+		}
+		delete(selected, l.Digest)
+		path, err := BlobPath(dir, l.Digest)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, Layer{
+			ExtendedLayer: model.ExtendedLayer{Digest: l.Digest, MediaType: l.MediaType, Size: l.Size},
+			Open:          OpenFile(path),
+		})
+	}
+	for d := range selected {
+		return nil, fmt.Errorf("OCI layout %s: no layer %s", dir, d)
+	}
+	return layers, nil
+}
+
+// FileLayer returns the layer stored in a tar file, compressed with gzip or not
+func FileLayer(path string) Layer {
+	return Layer{ExtendedLayer: model.ExtendedLayer{Digest: filepath.Base(path)}, Open: OpenFile(path)}
+}
+
+// BlobPath returns the path of a blob of an OCI layout, e.g. blobs/sha256/<hex>. The digest, read from the layout,
+// is rejected when it is not made of an algorithm and of an hex encoded value
+func BlobPath(dir string, digest string) (string, error) {
+	m := digestRegexp.FindStringSubmatch(digest)
+	if m == nil {
+		return "", fmt.Errorf("OCI layout %s: invalid digest %q", dir, digest)
+	}
+	if size, ok := digestSizes[m[1]]; ok && len(m[2]) != size {
+		return "", fmt.Errorf("OCI layout %s: invalid %s digest %q", dir, m[1], digest)
+	}
+	return filepath.Join(dir, "blobs", m[1], m[2]), nil
+}
+
+func readBlobJSON(path string, v interface{}) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
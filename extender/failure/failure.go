@@ -0,0 +1,101 @@
+// Package failure categorizes the errors returned up the stack to the main function. Each category has its own exit
+// code, so that the Kubernetes Job or the script running the application knows which step failed
+package failure
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Category is the step of the application which failed
+type Category string
+
+const (
+	Config   Category = "config"   // Invalid flags, env vars or config file
+	Metadata Category = "metadata" // Invalid metadata file, group file, extension descriptors, args file or Dockerfiles
+	Pull     Category = "pull"     // The base image or its layers cannot be fetched
+	Build    Category = "build"    // The engine cannot build a Dockerfile
+	Export   Category = "export"   // The image built or its layers cannot be read or stored, e.g. as an OCI layout
+	Extract  Category = "extract"  // The layers cannot be applied to, or rolled back from, the root FS dir
+	Verify   Category = "verify"   // The files searched do not exist under the root FS dir
+)
+
+// ExitCodeUnknown is the exit code of the errors which have no category
+const ExitCodeUnknown = 1
+
+var exitCodes = map[Category]int{
+	Config:   10,
+	Metadata: 11,
+	Pull:     12,
+	Build:    13,
+	Export:   14,
+	Extract:  15,
+	Verify:   16,
+}
+
+// Error is an error of a category
+type Error struct {
+	Category Category
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error of the category
+func New(category Category, format string, args ...interface{}) error {
+	return &Error{Category: category, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap returns the error as an error of the category. An error which already has a category keeps it, as it has been
+// categorized closer to its cause
+func Wrap(category Category, err error) error {
+	if err == nil {
+		return nil
+	}
+	if CategoryOf(err) != "" {
+		return err
+	}
+	return &Error{Category: category, Err: err}
+}
+
+// Wrapf prefixes the message of the error and returns it as an error of the category, unless it already has one
+func Wrapf(category Category, err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	if c := CategoryOf(err); c != "" {
+		category = c
+	}
+	return &Error{Category: category, Err: fmt.Errorf(format+": %w", append(args, err)...)}
+}
+
+// CategoryOf returns the category of the error, empty when it has none
+func CategoryOf(err error) Category {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Category
+	}
+	return ""
+}
+
+// ExitCode returns the exit code of the category of the error
+func ExitCode(err error) int {
+	if code, ok := exitCodes[CategoryOf(err)]; ok {
+		return code
+	}
+	return ExitCodeUnknown
+}
+
+// Summary returns the one line summary of the error printed before exiting
+func Summary(err error) string {
+	if c := CategoryOf(err); c != "" {
+		return fmt.Sprintf("%s error (exit code %d): %s", c, ExitCode(err), err)
+	}
+	return fmt.Sprintf("error (exit code %d): %s", ExitCode(err), err)
+}
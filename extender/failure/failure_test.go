@@ -0,0 +1,38 @@
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	cause := errors.New("manifest unknown")
+	pull := Wrapf(Pull, cause, "base image %s", "ubuntu")
+	// The category of the cause is kept when the error is returned up the stack
+	build := Wrapf(Build, fmt.Errorf("dockerfile curl: %w", pull), "build of the Dockerfile %s", "curl/Dockerfile")
+
+	if CategoryOf(build) != Pull || ExitCode(build) != 12 {
+		t.Errorf("got %s with exit code %d, want pull with 12", CategoryOf(build), ExitCode(build))
+	}
+	if !errors.Is(build, cause) {
+		t.Error("the cause must be unwrapped")
+	}
+	if want := "pull error (exit code 12): build of the Dockerfile curl/Dockerfile: dockerfile curl: base image ubuntu: manifest unknown"; Summary(build) != want {
+		t.Errorf("got %q, want %q", Summary(build), want)
+	}
+	if Wrap(Build, nil) != nil || Wrapf(Build, nil, "nothing") != nil {
+		t.Error("a nil error must stay nil")
+	}
+
+	if err := errors.New("unexpected"); ExitCode(err) != ExitCodeUnknown || Summary(err) != "error (exit code 1): unexpected" {
+		t.Errorf("unexpected exit code %d or summary %q", ExitCode(err), Summary(err))
+	}
+	codes := map[int]Category{}
+	for c, code := range exitCodes {
+		if other, ok := codes[code]; ok {
+			t.Errorf("%s and %s have the same exit code %d", c, other, code)
+		}
+		codes[code] = c
+	}
+}
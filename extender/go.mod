@@ -0,0 +1,13 @@
+module github.com/redhat-buildpacks/poc/extender
+
+go 1.16
+
+require (
+	github.com/BurntSushi/toml v1.0.0
+	github.com/pkg/errors v0.9.1
+	github.com/redhat-buildpacks/poc/layer v0.0.0
+	github.com/sirupsen/logrus v1.8.1
+)
+
+// The layer applier shared by the engines
+replace github.com/redhat-buildpacks/poc/layer => ../layer
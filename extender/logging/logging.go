@@ -41,8 +41,7 @@ func Configure(level, format string, logTimestamp bool) error {
 	default:
 		return fmt.Errorf("not a valid log format: %q. Please specify one of (text, color, json)", format)
 	}
-	logrus.SetFormatter(formatter)
+	logrus.SetFormatter(&redactingFormatter{formatter})
 
 	return nil
 }
-
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mask replaces the secret values in the log entries
+const Mask = "*****"
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// Redact registers secret values: they are replaced by the Mask in the message and the string fields of all the log
+// entries, whatever the formatter
+func Redact(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, v := range values {
+		if v != "" {
+			secrets = append(secrets, v)
+		}
+	}
+}
+
+// RedactString replaces the registered secret values of a string by the Mask
+func RedactString(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, v := range secrets {
+		s = strings.ReplaceAll(s, v, Mask)
+	}
+	return s
+}
+
+// redactingFormatter redacts the entries before formatting them
+type redactingFormatter struct {
+	logrus.Formatter
+}
+
+func (f *redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	redacted := *entry
+	redacted.Message = RedactString(entry.Message)
+	redacted.Data = make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		if s, ok := v.(string); ok {
+			v = RedactString(s)
+		}
+		redacted.Data[k] = v
+	}
+	return f.Formatter.Format(&redacted)
+}
+
+// RedactingWriter redacts the secret values of the lines written to the underlying writer, e.g. the output of the
+// RUN instructions written by an engine, which does not go through the logs. A line is only written once complete, so
+// that a secret written in several chunks is redacted as well
+type RedactingWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	line []byte
+}
+
+// NewRedactingWriter returns a writer redacting the lines written to w
+func NewRedactingWriter(w io.Writer) *RedactingWriter {
+	return &RedactingWriter{w: w}
+}
+
+func (r *RedactingWriter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.line = append(r.line, p...)
+	// The progress bars end their lines with a carriage return
+	for {
+		i := bytes.IndexAny(r.line, "\n\r")
+		if i < 0 {
+			break
+		}
+		if _, err := io.WriteString(r.w, RedactString(string(r.line[:i+1]))); err != nil {
+			return 0, err
+		}
+		r.line = append(r.line[:0], r.line[i+1:]...)
+	}
+	return len(p), nil
+}
+
+// Flush writes the last line when it does not end with a newline
+func (r *RedactingWriter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.line) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(r.w, RedactString(string(r.line)))
+	r.line = r.line[:0]
+	return err
+}
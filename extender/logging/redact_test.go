@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedact(t *testing.T) {
+	for _, format := range []string{FormatText, FormatJSON} {
+		if err := Configure("info", format, false); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		logrus.SetOutput(&out)
+		Redact("s3cr3t", "")
+		logrus.WithField("token", "s3cr3t").Infof("build arg: NPM_TOKEN=%s", "s3cr3t")
+		if strings.Contains(out.String(), "s3cr3t") || strings.Count(out.String(), Mask) != 2 {
+			t.Errorf("%s: secret not redacted: %s", format, out.String())
+		}
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	Redact("pa55w0rd")
+	var out bytes.Buffer
+	w := NewRedactingWriter(&out)
+	// The secret is written in several chunks, as by the RUN instructions
+	for _, chunk := range []string{"STEP 2: RUN echo pa5", "5w0rd\n", "Downloading 50%\rpa55w0rd", " done"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "STEP 2: RUN echo " + Mask + "\nDownloading 50%\r"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "pa55w0rd") || !strings.HasSuffix(out.String(), Mask+" done") {
+		t.Errorf("secret not redacted: %q", out.String())
+	}
+}
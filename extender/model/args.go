@@ -0,0 +1,176 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Arg statuses of the args report
+const (
+	ArgSet     = "set"     // A value is passed to the Dockerfile
+	ArgDefault = "default" // No value is passed, the default value of the ARG instruction is used
+	ArgMissing = "missing" // No value is passed and the ARG instruction has no default value
+)
+
+// predefinedArgs can be passed to any Dockerfile without being declared
+var predefinedArgs = []string{"HTTP_PROXY", "HTTPS_PROXY", "FTP_PROXY", "NO_PROXY", "ALL_PROXY"}
+
+// ResolvedArg is an arg passed to a Dockerfile, where its value comes from, e.g. metadata or env, and the sources whose
+// value it overrides
+type ResolvedArg struct {
+	Name      string   `json:"name"`
+	Value     string   `json:"value"`
+	Source    string   `json:"source"`
+	Overrides []string `json:"overrides,omitempty"`
+}
+
+func (a ResolvedArg) String() string {
+	if len(a.Overrides) > 0 {
+		return fmt.Sprintf("%s=%s (%s, overrides %s)", a.Name, a.Value, a.Source, strings.Join(a.Overrides, ", "))
+	}
+	return fmt.Sprintf("%s=%s (%s)", a.Name, a.Value, a.Source)
+}
+
+// DeclaredArg is an ARG instruction of a Dockerfile and the value it gets
+type DeclaredArg struct {
+	Name   string `json:"name"`
+	Line   int    `json:"line"`
+	Value  string `json:"value"`
+	Source string `json:"source,omitempty"`
+	Status string `json:"status"`
+}
+
+// ArgsReport cross-references the ARG instructions of a Dockerfile with the args passed to it
+type ArgsReport struct {
+	Dockerfile          string        `json:"dockerfile"`
+	Phase               Phase         `json:"phase"`
+	Declared            []DeclaredArg `json:"declared"`
+	Unused              []ResolvedArg `json:"unused"`
+	EffectiveDockerfile string        `json:"effective_dockerfile"`
+}
+
+// NewArgsReport resolves the ARG instructions of a Dockerfile like the engines do and renders the Dockerfile once the
+// args have been substituted. An ARG declared before the FROM is only visible by the FROM, unless it is declared again
+// without value in the stage
+func NewArgsReport(dockerfile string, phase Phase, instructions []Instruction, args []ResolvedArg) ArgsReport {
+	report := ArgsReport{Dockerfile: dockerfile, Phase: phase}
+	passed := map[string]ResolvedArg{}
+	for _, arg := range args {
+		passed[arg.Name] = arg
+	}
+
+	declared := map[string]bool{}
+	metaArgs := map[string]string{}
+	stageArgs := map[string]string{}
+	inStage := false
+	var lines []string
+	for _, i := range instructions {
+		switch i.Name {
+		case "FROM":
+			inStage = true
+			stageArgs = map[string]string{}
+			lines = append(lines, Expand(i.Original, metaArgs))
+			continue
+		case "ARG":
+			scope := stageArgs
+			if !inStage {
+				scope = metaArgs
+			}
+			for _, a := range i.Args {
+				kv := strings.SplitN(a, "=", 2)
+				d := DeclaredArg{Name: kv[0], Line: i.Line}
+				if arg, ok := passed[d.Name]; ok {
+					d.Value, d.Source, d.Status = arg.Value, arg.Source, ArgSet
+				} else if len(kv) == 2 {
+					d.Value, d.Status = Expand(kv[1], scope), ArgDefault
+				} else if v, ok := metaArgs[d.Name]; ok && inStage {
+					d.Value, d.Status = v, ArgDefault
+				} else {
+					d.Status = ArgMissing
+				}
+				scope[d.Name] = d.Value
+				declared[d.Name] = true
+				report.Declared = append(report.Declared, d)
+			}
+		}
+		if inStage {
+			lines = append(lines, Expand(i.Original, stageArgs))
+		} else {
+			lines = append(lines, i.Original)
+		}
+	}
+	report.EffectiveDockerfile = strings.Join(lines, "\n") + "\n"
+
+	for _, arg := range args {
+		if !declared[arg.Name] && !predefinedArg(arg.Name) {
+			report.Unused = append(report.Unused, arg)
+		}
+	}
+	sort.Slice(report.Unused, func(i, j int) bool { return report.Unused[i].Name < report.Unused[j].Name })
+	return report
+}
+
+func predefinedArg(name string) bool {
+	for _, a := range predefinedArgs {
+		if strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand substitutes the $name, ${name}, ${name:-word} and ${name:+word} references to the given args. The references
+// to other variables, e.g. the ENV or shell ones, are kept as is
+func Expand(s string, args map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			b.WriteString(`\$`)
+			i++
+			continue
+		}
+		if c != '$' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		if s[i+1] == '{' {
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				b.WriteString(s[i:])
+				break
+			}
+			ref := s[i+2 : i+end]
+			name, op, word := ref, "", ""
+			if j := strings.Index(ref, ":"); j > 0 && j+1 < len(ref) && (ref[j+1] == '-' || ref[j+1] == '+') {
+				name, op, word = ref[:j], ref[j:j+2], ref[j+2:]
+			}
+			v, ok := args[name]
+			switch {
+			case !ok:
+				b.WriteString(s[i : i+end+1])
+			case op == ":-" && v == "":
+				b.WriteString(Expand(word, args))
+			case op == ":+" && v != "":
+				b.WriteString(Expand(word, args))
+			case op == ":+":
+			default:
+				b.WriteString(v)
+			}
+			i += end
+			continue
+		}
+		j := i + 1
+		for j < len(s) && (s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+			j++
+		}
+		if v, ok := args[s[i+1:j]]; ok && j > i+1 {
+			b.WriteString(v)
+		} else {
+			b.WriteString(s[i:j])
+		}
+		i = j - 1
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewArgsReport(t *testing.T) {
+	instructions := []Instruction{
+		{Line: 1, Name: "ARG", Args: []string{"base_image"}, Original: "ARG base_image"},
+		{Line: 2, Name: "FROM", Args: []string{"${base_image}"}, Original: "FROM ${base_image}"},
+		{Line: 4, Name: "ARG", Args: []string{"some_arg"}, Original: "ARG some_arg"},
+		{Line: 5, Name: "RUN", Args: []string{"echo ${some_arg} > /opt/arg.txt"}, Original: "RUN echo ${some_arg} > /opt/arg.txt"},
+		{Line: 7, Name: "ARG", Args: []string{"build_id=0"}, Original: "ARG build_id=0"},
+		{Line: 8, Name: "RUN", Args: []string{"echo ${build_id} $HOME"}, Original: "RUN echo ${build_id} $HOME"},
+		{Line: 9, Name: "ARG", Args: []string{"version"}, Original: "ARG version"},
+	}
+	args := []ResolvedArg{
+		{Name: "base_image", Value: "ubuntu", Source: "metadata"},
+		{Name: "some_arg", Value: "some-arg-build-value", Source: "metadata"},
+		{Name: "runtime", Value: "nodejs", Source: "metadata"},
+		{Name: "http_proxy", Value: "http://proxy", Source: "env"},
+	}
+
+	report := NewArgsReport("Dockerfile", PhaseBuild, instructions, args)
+	expected := []DeclaredArg{
+		{Name: "base_image", Line: 1, Value: "ubuntu", Source: "metadata", Status: ArgSet},
+		{Name: "some_arg", Line: 4, Value: "some-arg-build-value", Source: "metadata", Status: ArgSet},
+		{Name: "build_id", Line: 7, Value: "0", Status: ArgDefault},
+		{Name: "version", Line: 9, Status: ArgMissing},
+	}
+	if !reflect.DeepEqual(expected, report.Declared) {
+		t.Errorf("\n%+v\n!=\n%+v", expected, report.Declared)
+	}
+	if len(report.Unused) != 1 || report.Unused[0].Name != "runtime" {
+		t.Errorf("unexpected unused args: %+v", report.Unused)
+	}
+	effective := `ARG base_image
+FROM ubuntu
+ARG some_arg
+RUN echo some-arg-build-value > /opt/arg.txt
+ARG build_id=0
+RUN echo 0 $HOME
+ARG version
+`
+	if report.EffectiveDockerfile != effective {
+		t.Errorf("\n%s\n!=\n%s", report.EffectiveDockerfile, effective)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	args := map[string]string{"a": "1", "empty": ""}
+	tests := map[string]string{
+		"$a ${a}":            "1 1",
+		"${empty:-x}":        "x",
+		"${a:-x}":            "1",
+		"${a:+y}${empty:+y}": "y",
+		"$b ${b} ${b:-x}":    "$b ${b} ${b:-x}",
+		`\$a`:                `\$a`,
+		"$a_b $":             "$a_b $",
+	}
+	for s, expected := range tests {
+		if got := Expand(s, args); got != expected {
+			t.Errorf("%q: got %q, expected %q", s, got, expected)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Sources of the build args, from the lowest to the highest precedence. The base_image arg of the chained Dockerfiles
+// is the image of the previous extension whatever its source. A run Dockerfile gets the run image as base_image when
+// no source defines it
+const (
+	SourceEnv               = "env"
+	SourceArgsFile          = "args file"
+	SourceMetadata          = "metadata"
+	SourceCLI               = "command line"
+	SourcePreviousExtension = "previous extension"
+	SourceRunImage          = "run image"
+)
+
+// DefaultArgEnvPrefixes are the prefixes of the env vars passed as build args to the Dockerfiles
+var DefaultArgEnvPrefixes = []string{"CNB_"}
+
+// ArgSources are the args passed to all the Dockerfiles, by source. The metadata args are those of each Dockerfile
+type ArgSources struct {
+	Env      []ResolvedArg
+	ArgsFile []ResolvedArg
+	CLI      []ResolvedArg
+}
+
+// Resolve merges the args of the sources with the args of a Dockerfile for a phase: env, then args file, metadata and
+// command line, a source overriding the values of the previous ones
+func (s ArgSources) Resolve(d Dockerfile, phase Phase) []ResolvedArg {
+	var args []ResolvedArg
+	for _, arg := range s.Env {
+		args = SetArg(args, arg)
+	}
+	for _, arg := range s.ArgsFile {
+		args = SetArg(args, arg)
+	}
+	if phase == PhaseRun {
+		for _, arg := range d.Args.RunArg {
+			args = SetArg(args, ResolvedArg{Name: arg.Key, Value: arg.Value, Source: SourceMetadata})
+		}
+	} else {
+		for _, arg := range d.Args.BuildArg {
+			args = SetArg(args, ResolvedArg{Name: arg.Key, Value: arg.Value, Source: SourceMetadata})
+		}
+	}
+	for _, arg := range s.CLI {
+		args = SetArg(args, arg)
+	}
+	return args
+}
+
+// WithoutSecrets removes the env vars holding the secrets of the Dockerfiles from the env args, so that they are never
+// passed as build args
+func (s ArgSources) WithoutSecrets(dockerfiles []Dockerfile) ArgSources {
+	secretEnvs := map[string]bool{}
+	for _, d := range dockerfiles {
+		for _, secret := range d.Secrets {
+			if secret.Env != "" {
+				secretEnvs[secret.Env] = true
+			}
+		}
+	}
+	env := s.Env
+	s.Env = nil
+	for _, arg := range env {
+		if !secretEnvs[arg.Name] {
+			s.Env = append(s.Env, arg)
+		}
+	}
+	return s
+}
+
+// SetArg adds an arg or overrides the value of the arg having the same name, which keeps its position
+func SetArg(args []ResolvedArg, arg ResolvedArg) []ResolvedArg {
+	for i, a := range args {
+		if a.Name == arg.Name {
+			arg.Overrides = append(append([]string{}, a.Overrides...), a.Source)
+			args[i] = arg
+			return args
+		}
+	}
+	return append(args, arg)
+}
+
+// LookupArg returns the arg having the given name
+func LookupArg(args []ResolvedArg, name string) (ResolvedArg, bool) {
+	for _, arg := range args {
+		if arg.Name == name {
+			return arg, true
+		}
+	}
+	return ResolvedArg{}, false
+}
+
+// ArgStrings returns the args as name=value strings
+func ArgStrings(args []ResolvedArg) []string {
+	var s []string
+	for _, arg := range args {
+		s = append(s, arg.Name+"="+arg.Value)
+	}
+	return s
+}
+
+// ArgMap returns the values of the args by name
+func ArgMap(args []ResolvedArg) map[string]string {
+	m := make(map[string]string, len(args))
+	for _, arg := range args {
+		m[arg.Name] = arg.Value
+	}
+	return m
+}
+
+// ParseArg parses a name=value arg. Only the first = separates the name from the value
+func ParseArg(s, source string) (ResolvedArg, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return ResolvedArg{}, fmt.Errorf("invalid %s arg %q, expected name=value", source, s)
+	}
+	return ResolvedArg{Name: kv[0], Value: kv[1], Source: source}, nil
+}
+
+// EnvArgs returns, sorted by name, the env vars whose name starts with one of the prefixes. The env vars are given as
+// name=value, as by os.Environ
+func EnvArgs(environ []string, prefixes []string) []ResolvedArg {
+	var args []ResolvedArg
+	for _, env := range environ {
+		arg, err := ParseArg(env, SourceEnv)
+		if err != nil {
+			continue
+		}
+		for _, prefix := range prefixes {
+			if prefix = strings.TrimSpace(prefix); prefix != "" && strings.HasPrefix(arg.Name, prefix) {
+				args = append(args, arg)
+				break
+			}
+		}
+	}
+	sort.Slice(args, func(i, j int) bool { return args[i].Name < args[j].Name })
+	return args
+}
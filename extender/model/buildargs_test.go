@@ -0,0 +1,83 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolvePrecedence(t *testing.T) {
+	sources := ArgSources{
+		Env: []ResolvedArg{
+			{Name: "CNB_STACK_ID", Value: "io.buildpacks.stacks.bionic", Source: SourceEnv},
+			{Name: "some_arg", Value: "env", Source: SourceEnv},
+		},
+		ArgsFile: []ResolvedArg{{Name: "some_arg", Value: "file", Source: SourceArgsFile}},
+		CLI:      []ResolvedArg{{Name: "build_id", Value: "42", Source: SourceCLI}},
+	}
+	d := Dockerfile{Args: DockerfileArg{
+		BuildArg: []BuildArg{{Key: "some_arg", Value: "build"}, {Key: "build_id", Value: "0"}},
+		RunArg:   []RunArg{{Key: "some_arg", Value: "run"}},
+	}}
+
+	got := sources.Resolve(d, PhaseBuild)
+	want := []ResolvedArg{
+		{Name: "CNB_STACK_ID", Value: "io.buildpacks.stacks.bionic", Source: SourceEnv},
+		{Name: "some_arg", Value: "build", Source: SourceMetadata, Overrides: []string{SourceEnv, SourceArgsFile}},
+		{Name: "build_id", Value: "42", Source: SourceCLI, Overrides: []string{SourceMetadata}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("build args:\n got %v\nwant %v", got, want)
+	}
+
+	got = sources.Resolve(d, PhaseRun)
+	if arg, _ := LookupArg(got, "some_arg"); arg.Value != "run" {
+		t.Errorf("run arg some_arg: got %v, want the run arg of the metadata", arg)
+	}
+	if arg, _ := LookupArg(got, "build_id"); arg.Value != "42" || arg.Overrides != nil {
+		t.Errorf("run arg build_id: got %v, want the command line value only", arg)
+	}
+	if got[0].String() != "CNB_STACK_ID=io.buildpacks.stacks.bionic (env)" {
+		t.Errorf("unexpected String(): %s", got[0])
+	}
+	if got[1].String() != "some_arg=run (metadata, overrides env, args file)" {
+		t.Errorf("unexpected String(): %s", got[1])
+	}
+}
+
+func TestEnvArgs(t *testing.T) {
+	environ := []string{
+		"CNB_USER_ID=1000",
+		"MY_CNB_VAR=ignored",
+		"CNB_PLATFORM_API=0.8",
+		"BP_OPTS=a=b=c",
+		"PATH=/usr/bin",
+	}
+	got := EnvArgs(environ, []string{"CNB_", " BP_"})
+	want := []ResolvedArg{
+		{Name: "BP_OPTS", Value: "a=b=c", Source: SourceEnv},
+		{Name: "CNB_PLATFORM_API", Value: "0.8", Source: SourceEnv},
+		{Name: "CNB_USER_ID", Value: "1000", Source: SourceEnv},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if args := EnvArgs(environ, []string{""}); args != nil {
+		t.Errorf("an empty prefix must not match, got %v", args)
+	}
+}
+
+func TestWithoutSecrets(t *testing.T) {
+	sources := ArgSources{Env: []ResolvedArg{
+		{Name: "CNB_NPM_TOKEN", Value: "s3cr3t", Source: SourceEnv},
+		{Name: "CNB_STACK_ID", Value: "bionic", Source: SourceEnv},
+	}}
+	dockerfiles := []Dockerfile{{}, {Secrets: []Secret{{ID: "npm_token", Env: "CNB_NPM_TOKEN"}, {ID: "cert", File: "cert.pem"}}}}
+	got := sources.WithoutSecrets(dockerfiles).Resolve(dockerfiles[0], PhaseBuild)
+	want := []ResolvedArg{{Name: "CNB_STACK_ID", Value: "bionic", Source: SourceEnv}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(sources.Env) != 2 {
+		t.Errorf("the sources must not be modified, got %v", sources.Env)
+	}
+}
@@ -0,0 +1,142 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExtensionDescriptorFileName is the descriptor of an extension, stored next to its Dockerfile
+const ExtensionDescriptorFileName = "extension.toml"
+
+// SupportedAPIs are the Buildpack API versions supported for the extensions
+var SupportedAPIs = []string{"0.7", "0.8", "0.9"}
+
+// Buildpack is an entry of the [[buildpacks]] table of the metadata file: a buildpack or an extension of the group
+type Buildpack struct {
+	API       string `toml:"api"`
+	ID        string `toml:"id"`
+	Version   string `toml:"version"`
+	Homepage  string `toml:"homepage"`
+	Extension bool   `toml:"extension"`
+}
+
+// ExtensionDescriptor is the content of an extension.toml file
+type ExtensionDescriptor struct {
+	API       string        `toml:"api"`
+	Extension ExtensionInfo `toml:"extension"`
+}
+
+type ExtensionInfo struct {
+	ID          string `toml:"id"`
+	Name        string `toml:"name"`
+	Version     string `toml:"version"`
+	Homepage    string `toml:"homepage"`
+	Description string `toml:"description"`
+}
+
+// Extension is an extension declared by the metadata file or by an extension.toml descriptor
+type Extension struct {
+	ID      string
+	Name    string
+	Version string
+	API     string
+}
+
+func (e Extension) String() string {
+	s := e.ID
+	if e.Version != "" {
+		s += "@" + e.Version
+	}
+	if e.Name != "" {
+		s += " (" + e.Name + ")"
+	}
+	return s
+}
+
+// Extensions cross-checks the buildpacks of the metadata file, the descriptors of the Dockerfiles (by Dockerfile path)
+// and the extension_id of the Dockerfiles. It returns the extensions declared, by ID
+func (m Metadata) Extensions(descriptors map[string]ExtensionDescriptor) (map[string]Extension, error) {
+	var problems []string
+	extensions := map[string]Extension{}
+	buildpacks := map[string]bool{}
+	for _, bp := range m.Buildpacks {
+		if buildpacks[bp.ID] {
+			problems = append(problems, fmt.Sprintf("buildpack %q is declared more than once", bp.ID))
+			continue
+		}
+		buildpacks[bp.ID] = true
+		if !supportedAPI(bp.API) {
+			problems = append(problems, fmt.Sprintf("buildpack %q: api %q is not supported, expected one of: %s", bp.ID, bp.API, strings.Join(SupportedAPIs, ", ")))
+		}
+		if bp.Extension {
+			extensions[bp.ID] = Extension{ID: bp.ID, Version: bp.Version, API: bp.API}
+		}
+	}
+
+	for _, d := range m.Dockerfiles {
+		descriptor, ok := descriptors[d.Path]
+		if !ok {
+			continue
+		}
+		id := descriptor.Extension.ID
+		if d.ExtensionID != "" && id != d.ExtensionID {
+			problems = append(problems, fmt.Sprintf("Dockerfile %s: the extension_id %q does not match the id %q of its %s", d.Path, d.ExtensionID, id, ExtensionDescriptorFileName))
+			continue
+		}
+		if !supportedAPI(descriptor.API) {
+			problems = append(problems, fmt.Sprintf("extension %q: api %q is not supported, expected one of: %s", id, descriptor.API, strings.Join(SupportedAPIs, ", ")))
+		}
+		if buildpacks[id] {
+			if _, ok := extensions[id]; !ok {
+				problems = append(problems, fmt.Sprintf("extension %q is declared as a buildpack", id))
+				continue
+			}
+		}
+		// The descriptor completes the declaration of the metadata file
+		ext := extensions[id]
+		ext.ID = id
+		ext.Name = descriptor.Extension.Name
+		if ext.Version == "" {
+			ext.Version = descriptor.Extension.Version
+		} else if descriptor.Extension.Version != "" && descriptor.Extension.Version != ext.Version {
+			problems = append(problems, fmt.Sprintf("extension %q: version %q of the metadata file does not match the version %q of its %s", id, ext.Version, descriptor.Extension.Version, ExtensionDescriptorFileName))
+		}
+		if ext.API == "" {
+			ext.API = descriptor.API
+		}
+		extensions[id] = ext
+	}
+
+	for _, d := range m.Dockerfiles {
+		if d.ExtensionID == "" {
+			continue
+		}
+		if _, ok := extensions[d.ExtensionID]; !ok {
+			problems = append(problems, fmt.Sprintf("Dockerfile %s: extension_id %q is not a declared extension", d.Path, d.ExtensionID))
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid metadata:\n- %s", strings.Join(problems, "\n- "))
+	}
+	return extensions, nil
+}
+
+func supportedAPI(api string) bool {
+	for _, a := range SupportedAPIs {
+		if a == api {
+			return true
+		}
+	}
+	return false
+}
+
+// DockerfileExtension returns the extension of a Dockerfile among the extensions returned by Metadata.Extensions.
+// Only its ID is known when the Dockerfile has no extension.toml descriptor and is not declared as a buildpack
+func DockerfileExtension(extensions map[string]Extension, d Dockerfile) Extension {
+	extension, ok := extensions[d.ExtensionID]
+	if !ok {
+		extension.ID = d.ExtensionID
+	}
+	return extension
+}
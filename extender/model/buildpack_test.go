@@ -0,0 +1,101 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetadataExtensions(t *testing.T) {
+	curl := Buildpack{API: "0.7", ID: "samples/curl", Version: "0.0.1", Extension: true}
+	rebasable := Buildpack{API: "0.7", ID: "samples/rebasable", Version: "0.0.1", Extension: true}
+	nodejs := Buildpack{API: "0.7", ID: "samples/nodejs", Version: "0.0.1"}
+	descriptor := ExtensionDescriptor{API: "0.7", Extension: ExtensionInfo{ID: "samples/rebasable", Name: "Rebasable Extension", Version: "0.0.1"}}
+
+	tests := []struct {
+		name        string
+		metadata    Metadata
+		descriptors map[string]ExtensionDescriptor
+		problem     string
+	}{
+		{
+			name: "declared extensions",
+			metadata: Metadata{
+				Buildpacks:  []Buildpack{curl, rebasable},
+				Dockerfiles: []Dockerfile{{ExtensionID: "samples/curl", Path: "curl/Dockerfile"}, {ExtensionID: "samples/rebasable", Path: "rebasable/Dockerfile"}},
+			},
+			descriptors: map[string]ExtensionDescriptor{"rebasable/Dockerfile": descriptor},
+		},
+		{
+			name:        "extension declared by its descriptor only",
+			metadata:    Metadata{Dockerfiles: []Dockerfile{{ExtensionID: "samples/rebasable", Path: "rebasable/Dockerfile"}}},
+			descriptors: map[string]ExtensionDescriptor{"rebasable/Dockerfile": descriptor},
+		},
+		{
+			name:     "Dockerfile without extension_id",
+			metadata: Metadata{Dockerfiles: []Dockerfile{{Path: "Dockerfile"}}},
+		},
+		{
+			name:     "undeclared extension",
+			metadata: Metadata{Buildpacks: []Buildpack{curl}, Dockerfiles: []Dockerfile{{ExtensionID: "samples/rebasable", Path: "rebasable/Dockerfile"}}},
+			problem:  `extension_id "samples/rebasable" is not a declared extension`,
+		},
+		{
+			name:     "duplicate id",
+			metadata: Metadata{Buildpacks: []Buildpack{curl, curl}},
+			problem:  `buildpack "samples/curl" is declared more than once`,
+		},
+		{
+			name:     "unsupported api",
+			metadata: Metadata{Buildpacks: []Buildpack{{API: "0.2", ID: "samples/curl", Extension: true}}},
+			problem:  `api "0.2" is not supported`,
+		},
+		{
+			name:     "buildpack used as extension",
+			metadata: Metadata{Buildpacks: []Buildpack{nodejs}, Dockerfiles: []Dockerfile{{ExtensionID: "samples/nodejs", Path: "nodejs/Dockerfile"}}},
+			problem:  `extension_id "samples/nodejs" is not a declared extension`,
+		},
+		{
+			name:        "descriptor id mismatch",
+			metadata:    Metadata{Buildpacks: []Buildpack{curl}, Dockerfiles: []Dockerfile{{ExtensionID: "samples/curl", Path: "rebasable/Dockerfile"}}},
+			descriptors: map[string]ExtensionDescriptor{"rebasable/Dockerfile": descriptor},
+			problem:     `does not match the id "samples/rebasable"`,
+		},
+		{
+			name: "version mismatch",
+			metadata: Metadata{
+				Buildpacks:  []Buildpack{{API: "0.7", ID: "samples/rebasable", Version: "0.0.2", Extension: true}},
+				Dockerfiles: []Dockerfile{{ExtensionID: "samples/rebasable", Path: "rebasable/Dockerfile"}},
+			},
+			descriptors: map[string]ExtensionDescriptor{"rebasable/Dockerfile": descriptor},
+			problem:     `version "0.0.2" of the metadata file does not match the version "0.0.1"`,
+		},
+	}
+	for _, test := range tests {
+		_, err := test.metadata.Extensions(test.descriptors)
+		if test.problem == "" && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)) {
+			t.Errorf("%s: expected an error containing %q, got: %v", test.name, test.problem, err)
+		}
+	}
+}
+
+func TestDockerfileExtension(t *testing.T) {
+	extensions, err := Metadata{
+		Buildpacks:  []Buildpack{{API: "0.7", ID: "samples/curl", Version: "0.0.1", Extension: true}},
+		Dockerfiles: []Dockerfile{{ExtensionID: "samples/curl", Path: "curl/Dockerfile"}},
+	}.Extensions(map[string]ExtensionDescriptor{
+		"curl/Dockerfile": {API: "0.7", Extension: ExtensionInfo{ID: "samples/curl", Name: "Curl Extension"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extension := DockerfileExtension(extensions, Dockerfile{ExtensionID: "samples/curl"})
+	if got, expected := extension.String(), "samples/curl@0.0.1 (Curl Extension)"; got != expected {
+		t.Errorf("%q != %q", got, expected)
+	}
+	if got := DockerfileExtension(extensions, Dockerfile{}).ID; got != "" {
+		t.Errorf("unexpected extension %q", got)
+	}
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"github.com/redhat-buildpacks/poc/layer"
+	"path/filepath"
+)
+
+type Dockerfile struct {
+	ExtensionID     string                `toml:"extension_id"`
+	Path            string                `toml:"path"`
+	Context         string                `toml:"context"` // Build context dir. See Paths
+	Build           *bool                 `toml:"build"`   // Built during the build phase. Default is true
+	Run             *bool                 `toml:"run"`     // Built during the run phase. Default is true
+	Args            DockerfileArg         `toml:"args"`
+	OverwritePolicy layer.OverwritePolicy `toml:"overwrite_policy"` // Overrides the global policy for the files of this Dockerfile
+	Secrets         []Secret              `toml:"secrets"`
+}
+
+// Builds returns true when the Dockerfile is built during the phase, i.e. unless its build or run key is false
+func (d Dockerfile) Builds(phase Phase) bool {
+	switch phase {
+	case PhaseBuild:
+		return d.Build == nil || *d.Build
+	case PhaseRun:
+		return d.Run == nil || *d.Run
+	}
+	return true
+}
+
+// Paths resolves the path of the Dockerfile and the dir of its build context:
+// - the path of the Dockerfile is relative to the workspace dir, even when it starts with a /,
+// - when no context is defined, the context is the workspace dir,
+// - a context starting with a / is relative to the workspace dir,
+// - another context is relative to the dir of the Dockerfile, e.g. "." is the dir of the Dockerfile
+func (d Dockerfile) Paths(workspaceDir string) (string, string) {
+	pathToDockerFile := filepath.Join(workspaceDir, d.Path)
+	switch {
+	case d.Context == "":
+		return pathToDockerFile, workspaceDir
+	case filepath.IsAbs(d.Context):
+		return pathToDockerFile, filepath.Join(workspaceDir, d.Context)
+	}
+	return pathToDockerFile, filepath.Join(filepath.Dir(pathToDockerFile), d.Context)
+}
+
+type DockerfileArg struct {
+	BuildArg []BuildArg `toml:"build"` //map[string]string --> won't work: https://github.com/BurntSushi/toml/issues/195
+	RunArg   []RunArg   `toml:"run"`   //map[string]string
+}
+
+type BuildArg struct {
+	Key   string `toml:"name"`
+	Value string `toml:"value"`
+}
+
+type RunArg struct {
+	Key   string `toml:"name"`
+	Value string `toml:"value"`
+}
+
+// SecretsDir is the dir where the RUN instructions find the secrets, as with: RUN --mount=type=secret,id=<id>
+const SecretsDir = "/run/secrets"
+
+// Secret is a value needed by the RUN instructions of a Dockerfile, e.g. the token of a private package repository. Its
+// value is read from an env var or a file and mounted as SecretsDir/<id>: it is never passed as build arg, logged or
+// stored in the image
+type Secret struct {
+	ID   string `toml:"id"`
+	Env  string `toml:"env"`  // Env var holding the value
+	File string `toml:"file"` // File holding the value, relative to the workspace dir when it does not start with a /
+}
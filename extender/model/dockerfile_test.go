@@ -0,0 +1,23 @@
+package model
+
+import "testing"
+
+func TestDockerfilePaths(t *testing.T) {
+	tests := []struct {
+		dockerfile Dockerfile
+		path       string
+		context    string
+	}{
+		{dockerfile: Dockerfile{Path: "/layers/curl/Dockerfile"}, path: "/workspace/layers/curl/Dockerfile", context: "/workspace"},
+		{dockerfile: Dockerfile{Path: "layers/curl/Dockerfile", Context: "."}, path: "/workspace/layers/curl/Dockerfile", context: "/workspace/layers/curl"},
+		{dockerfile: Dockerfile{Path: "/layers/curl/Dockerfile", Context: "files"}, path: "/workspace/layers/curl/Dockerfile", context: "/workspace/layers/curl/files"},
+		{dockerfile: Dockerfile{Path: "/layers/curl/Dockerfile", Context: "/files"}, path: "/workspace/layers/curl/Dockerfile", context: "/workspace/files"},
+		{dockerfile: Dockerfile{Path: "../layers/curl/Dockerfile", Context: ".."}, path: "/layers/curl/Dockerfile", context: "/layers"},
+	}
+	for _, test := range tests {
+		path, context := test.dockerfile.Paths("/workspace")
+		if path != test.path || context != test.context {
+			t.Errorf("%+v: got %s, %s, expected %s, %s", test.dockerfile, path, context, test.path, test.context)
+		}
+	}
+}
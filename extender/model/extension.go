@@ -0,0 +1,35 @@
+package model
+
+// RunImageExtension is the artifact produced by a run Dockerfile: the extended run image stored as an OCI layout
+// and the layers added on top of the run image
+type RunImageExtension struct {
+	ExtensionID      string          `json:"extension_id"`
+	ExtensionName    string          `json:"extension_name,omitempty"`
+	ExtensionVersion string          `json:"extension_version,omitempty"`
+	Dockerfile       string          `json:"dockerfile"`
+	RunImage         string          `json:"run_image"`
+	Layout           string          `json:"layout"`
+	Digest           string          `json:"digest"`
+	Layers           []ExtendedLayer `json:"layers"`
+}
+
+// ExtendedLayer is a layer of the extended image which does not belong to its base image
+type ExtendedLayer struct {
+	Digest    string `json:"digest"`
+	DiffID    string `json:"diff_id"`
+	MediaType string `json:"media_type"`
+	Size      int64  `json:"size"`
+}
+
+// ExtensionLayers are the layers added by an extension Dockerfile on top of its base image. In chained mode, the base
+// image is the image produced by the previous extension of the phase
+type ExtensionLayers struct {
+	ExtensionID      string          `json:"extension_id"`
+	ExtensionName    string          `json:"extension_name,omitempty"`
+	ExtensionVersion string          `json:"extension_version,omitempty"`
+	Phase            Phase           `json:"phase"`
+	Dockerfile       string          `json:"dockerfile"`
+	BaseImage        string          `json:"base_image"`
+	Image            string          `json:"image"`
+	Layers           []ExtendedLayer `json:"layers"`
+}
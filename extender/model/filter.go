@@ -0,0 +1,64 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Phase is the phase of the CNB build during which a Dockerfile is applied
+type Phase string
+
+const (
+	// PhaseBuild extends the build image
+	PhaseBuild Phase = "build"
+	// PhaseRun extends the run image
+	PhaseRun Phase = "run"
+	// PhaseAll processes both the build and the run Dockerfiles
+	PhaseAll Phase = "all"
+)
+
+// ParsePhase returns the Phase matching s
+func ParsePhase(s string) (Phase, error) {
+	switch p := Phase(strings.ToLower(strings.TrimSpace(s))); p {
+	case PhaseBuild, PhaseRun, PhaseAll:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid phase %q, expected one of: %s, %s, %s", s, PhaseBuild, PhaseRun, PhaseAll)
+}
+
+// DockerfileFilter selects the Dockerfiles of the metadata file to be built
+type DockerfileFilter struct {
+	// Phase selected. Empty means all
+	Phase Phase
+	// Include lists the extension IDs to be built. Empty means all
+	Include []string
+	// Exclude lists the extension IDs which should not be built
+	Exclude []string
+}
+
+// SkipReason returns why the Dockerfile should not be built during the phase (build or run), or an empty string when
+// it should be built
+func (f DockerfileFilter) SkipReason(d Dockerfile, phase Phase) string {
+	if f.Phase != "" && f.Phase != PhaseAll && f.Phase != phase {
+		return fmt.Sprintf("the %s phase is not selected (phase: %s)", phase, f.Phase)
+	}
+	if !d.Builds(phase) {
+		return fmt.Sprintf("the Dockerfile sets %s = false", phase)
+	}
+	if len(f.Include) > 0 && !contains(f.Include, d.ExtensionID) {
+		return fmt.Sprintf("extension %q is not part of the included extensions %v", d.ExtensionID, f.Include)
+	}
+	if contains(f.Exclude, d.ExtensionID) {
+		return fmt.Sprintf("extension %q is excluded", d.ExtensionID)
+	}
+	return ""
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
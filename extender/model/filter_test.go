@@ -0,0 +1,85 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestParsePhase(t *testing.T) {
+	for _, s := range []string{"build", "Run", " all "} {
+		if _, err := ParsePhase(s); err != nil {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+	if _, err := ParsePhase("launch"); err == nil {
+		t.Error("expected an error for an unknown phase")
+	}
+}
+
+func TestDockerfileFilter(t *testing.T) {
+	curl := Dockerfile{ExtensionID: "sample/curl", Build: boolPtr(true), Run: boolPtr(true)}
+	nodejs := Dockerfile{ExtensionID: "sample/nodejs", Build: boolPtr(true), Run: boolPtr(false)}
+	runOnly := Dockerfile{ExtensionID: "sample/run", Build: boolPtr(false), Run: boolPtr(true)}
+
+	tests := []struct {
+		name       string
+		filter     DockerfileFilter
+		dockerfile Dockerfile
+		phase      Phase
+		skipped    bool
+	}{
+		{name: "default filter, build phase", dockerfile: curl, phase: PhaseBuild},
+		{name: "default filter, run phase", dockerfile: curl, phase: PhaseRun},
+		{name: "build = false", dockerfile: runOnly, phase: PhaseBuild, skipped: true},
+		{name: "run = false", dockerfile: nodejs, phase: PhaseRun, skipped: true},
+		{name: "run phase only", filter: DockerfileFilter{Phase: PhaseRun}, dockerfile: curl, phase: PhaseBuild, skipped: true},
+		{name: "build phase only", filter: DockerfileFilter{Phase: PhaseBuild}, dockerfile: curl, phase: PhaseBuild},
+		{name: "all phases", filter: DockerfileFilter{Phase: PhaseAll}, dockerfile: runOnly, phase: PhaseRun},
+		{name: "included", filter: DockerfileFilter{Include: []string{"sample/curl"}}, dockerfile: curl, phase: PhaseBuild},
+		{name: "not included", filter: DockerfileFilter{Include: []string{"sample/curl"}}, dockerfile: nodejs, phase: PhaseBuild, skipped: true},
+		{name: "excluded", filter: DockerfileFilter{Exclude: []string{"sample/nodejs"}}, dockerfile: nodejs, phase: PhaseBuild, skipped: true},
+		{name: "included and excluded", filter: DockerfileFilter{Include: []string{"sample/curl"}, Exclude: []string{"sample/curl"}}, dockerfile: curl, phase: PhaseRun, skipped: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reason := test.filter.SkipReason(test.dockerfile, test.phase)
+			if skipped := reason != ""; skipped != test.skipped {
+				t.Errorf("expected skipped: %v, got reason: %q", test.skipped, reason)
+			}
+		})
+	}
+}
+
+func TestDockerfileOmittedPhase(t *testing.T) {
+	var metadata Metadata
+	if _, err := toml.Decode(`
+[[dockerfiles]]
+extension_id = "sample/curl"
+path = "curl/Dockerfile"
+
+[[dockerfiles]]
+extension_id = "sample/nodejs"
+path = "nodejs/Dockerfile"
+run = false
+`, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	curl, nodejs := metadata.Dockerfiles[0], metadata.Dockerfiles[1]
+	// The Dockerfile is built during the phases whose key is omitted
+	for _, phase := range []Phase{PhaseBuild, PhaseRun} {
+		if reason := (DockerfileFilter{}).SkipReason(curl, phase); reason != "" {
+			t.Errorf("%s phase: unexpected reason %q", phase, reason)
+		}
+	}
+	if !nodejs.Builds(PhaseBuild) || nodejs.Builds(PhaseRun) {
+		t.Errorf("unexpected phases of %+v", nodejs)
+	}
+	if reason := (DockerfileFilter{}).SkipReason(nodejs, PhaseRun); reason != "the Dockerfile sets run = false" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
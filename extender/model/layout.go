@@ -0,0 +1,41 @@
+package model
+
+// Files and dirs of the CNB platform layers dir
+const (
+	GroupFileName      = "group.toml"
+	GeneratedDirName   = "generated"
+	BuildArgsFileName  = "build.toml"
+	LaunchArgsFileName = "launch.toml"
+)
+
+// Group is the content of the group.toml file written by the CNB detector: the buildpacks and the extensions selected,
+// in order
+type Group struct {
+	Buildpacks []GroupEntry `toml:"group"`
+	Extensions []GroupEntry `toml:"group-extensions"`
+}
+
+type GroupEntry struct {
+	ID       string `toml:"id"`
+	Version  string `toml:"version"`
+	API      string `toml:"api"`
+	Homepage string `toml:"homepage"`
+	Optional bool   `toml:"optional"`
+}
+
+// ArgsFile is the content of the build.toml and launch.toml files of an extension
+type ArgsFile struct {
+	Args []BuildArg `toml:"args"`
+}
+
+// Metadata converts the group to the buildpacks table of a metadata file. The Dockerfiles are not part of the group
+func (g Group) Metadata() Metadata {
+	var metadata Metadata
+	for _, e := range g.Buildpacks {
+		metadata.Buildpacks = append(metadata.Buildpacks, Buildpack{API: e.API, ID: e.ID, Version: e.Version, Homepage: e.Homepage})
+	}
+	for _, e := range g.Extensions {
+		metadata.Buildpacks = append(metadata.Buildpacks, Buildpack{API: e.API, ID: e.ID, Version: e.Version, Homepage: e.Homepage, Extension: true})
+	}
+	return metadata
+}
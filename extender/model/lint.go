@@ -0,0 +1,94 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LintLevel is the strictness of the lint of the extension Dockerfiles
+type LintLevel string
+
+const (
+	LintOff   LintLevel = "off"   // The Dockerfiles are not checked
+	LintWarn  LintLevel = "warn"  // The problems are logged and the Dockerfiles are built
+	LintError LintLevel = "error" // Nothing is built when a problem is found
+)
+
+func ParseLintLevel(s string) (LintLevel, error) {
+	switch l := LintLevel(strings.ToLower(strings.TrimSpace(s))); l {
+	case LintOff, LintWarn, LintError:
+		return l, nil
+	}
+	return "", fmt.Errorf("unknown lint level %q, expected one of: %s, %s, %s", s, LintOff, LintWarn, LintError)
+}
+
+// Instruction is an instruction of a Dockerfile as parsed by the engine
+type Instruction struct {
+	Line     int
+	Name     string // Upper case, e.g. FROM
+	Args     []string
+	Flags    []string // e.g. --from=builder
+	Original string   // The instruction as written in the Dockerfile, the continuation lines being joined
+}
+
+// AllowedInstructions are the instructions allowed in an extension Dockerfile. USER is not part of them as the user of
+// the base image must be kept
+var AllowedInstructions = []string{"ADD", "ARG", "COPY", "ENV", "FROM", "LABEL", "RUN", "SHELL", "WORKDIR"}
+
+// LintDockerfile checks the instructions of an extension Dockerfile: it must have a single stage built from the
+// ${base_image} arg, declared before the FROM, and only use the allowed instructions
+func LintDockerfile(file string, instructions []Instruction) []Problem {
+	var problems []Problem
+	report := func(i Instruction, format string, a ...interface{}) {
+		problems = append(problems, Problem{File: file, Line: i.Line, Message: fmt.Sprintf(format, a...)})
+	}
+
+	from := 0
+	baseImageArg := false
+	for _, i := range instructions {
+		switch i.Name {
+		case "FROM":
+			from++
+			if from > 1 {
+				report(i, "multi-stage builds are not allowed")
+				continue
+			}
+			if len(i.Args) == 0 || (i.Args[0] != "${base_image}" && i.Args[0] != "$base_image") {
+				report(i, "FROM must use the base_image arg: FROM ${base_image}, got: FROM %s", strings.Join(i.Args, " "))
+			} else if !baseImageArg {
+				report(i, "the base_image arg must be declared before the FROM: ARG base_image")
+			}
+		case "ARG":
+			for _, arg := range i.Args {
+				if strings.SplitN(arg, "=", 2)[0] == "base_image" && from == 0 {
+					baseImageArg = true
+				}
+			}
+		case "USER":
+			report(i, "USER is not allowed: the user of the base image must be kept")
+		case "COPY", "ADD":
+			for _, flag := range i.Flags {
+				if strings.HasPrefix(flag, "--from") {
+					report(i, "%s %s is not allowed: the files cannot be copied from another stage or image", i.Name, flag)
+				}
+			}
+		default:
+			if !allowedInstruction(i.Name) {
+				report(i, "%s is not allowed, expected one of: %s", i.Name, strings.Join(AllowedInstructions, ", "))
+			}
+		}
+	}
+	if from == 0 {
+		problems = append(problems, Problem{File: file, Message: "FROM ${base_image} is missing"})
+	}
+	return problems
+}
+
+func allowedInstruction(name string) bool {
+	for _, n := range AllowedInstructions {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
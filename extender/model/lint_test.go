@@ -0,0 +1,67 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintDockerfile(t *testing.T) {
+	arg := Instruction{Line: 1, Name: "ARG", Args: []string{"base_image"}}
+	from := Instruction{Line: 2, Name: "FROM", Args: []string{"${base_image}"}}
+	run := Instruction{Line: 3, Name: "RUN", Args: []string{"echo hello"}}
+
+	tests := []struct {
+		name         string
+		instructions []Instruction
+		problems     []string
+	}{
+		{name: "valid", instructions: []Instruction{arg, from, run}},
+		{name: "arg with a default value", instructions: []Instruction{{Line: 1, Name: "ARG", Args: []string{"base_image=ubuntu"}}, from}},
+		{
+			name:         "hardcoded FROM",
+			instructions: []Instruction{{Line: 1, Name: "FROM", Args: []string{"ubuntu"}}, run},
+			problems:     []string{"f:1: FROM must use the base_image arg"},
+		},
+		{
+			name:         "base_image arg not declared",
+			instructions: []Instruction{from, run},
+			problems:     []string{"f:2: the base_image arg must be declared before the FROM"},
+		},
+		{
+			name:         "multi-stage",
+			instructions: []Instruction{arg, from, {Line: 5, Name: "FROM", Args: []string{"${base_image}"}}},
+			problems:     []string{"f:5: multi-stage builds are not allowed"},
+		},
+		{
+			name:         "USER",
+			instructions: []Instruction{arg, from, {Line: 3, Name: "USER", Args: []string{"root"}}},
+			problems:     []string{"f:3: USER is not allowed"},
+		},
+		{
+			name:         "COPY from another stage",
+			instructions: []Instruction{arg, from, {Line: 4, Name: "COPY", Args: []string{"/a", "/b"}, Flags: []string{"--from=builder"}}},
+			problems:     []string{"f:4: COPY --from=builder is not allowed"},
+		},
+		{
+			name:         "instruction not allowed",
+			instructions: []Instruction{arg, from, {Line: 6, Name: "ENTRYPOINT", Args: []string{"sh"}}},
+			problems:     []string{"f:6: ENTRYPOINT is not allowed"},
+		},
+		{name: "no FROM", instructions: []Instruction{arg, run}, problems: []string{"f: FROM ${base_image} is missing"}},
+	}
+	for _, test := range tests {
+		problems := LintDockerfile("f", test.instructions)
+		if len(problems) != len(test.problems) {
+			t.Errorf("%s: expected %d problem(s), got: %v", test.name, len(test.problems), problems)
+			continue
+		}
+		for i, p := range problems {
+			if !strings.HasPrefix(p.String(), test.problems[i]) {
+				t.Errorf("%s: %q does not start with %q", test.name, p, test.problems[i])
+			}
+		}
+	}
+	if _, err := ParseLintLevel("strict"); err == nil {
+		t.Error("expected an error for an unknown lint level")
+	}
+}
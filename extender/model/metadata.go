@@ -0,0 +1,6 @@
+package model
+
+type Metadata struct {
+	Buildpacks  []Buildpack  `toml:"buildpacks"`
+	Dockerfiles []Dockerfile `toml:"dockerfiles"`
+}
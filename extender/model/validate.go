@@ -0,0 +1,285 @@
+package model
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/redhat-buildpacks/poc/layer"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Problem is an issue found in a metadata file. The line is 0 when it is not known
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.File, p.Message)
+}
+
+// DecodeMetadata decodes the content of a metadata file and reports the unknown keys, the values having a wrong type,
+// the Dockerfiles without path, the duplicate arg names, the invalid secrets and the invalid overwrite policies. An error is returned when
+// the content cannot be decoded at all: it is then also reported as a problem
+func DecodeMetadata(file string, data []byte) (Metadata, []Problem, error) {
+	var metadata Metadata
+	var raw map[string]interface{}
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		problem := Problem{File: file, Message: err.Error()}
+		if pe, ok := err.(toml.ParseError); ok {
+			problem.Line = pe.Line
+		}
+		return metadata, []Problem{problem}, err
+	}
+
+	c := &checker{file: file, lines: indexLines(string(data))}
+	c.checkTable(raw, reflect.TypeOf(metadata), "")
+	if c.mismatches > 0 {
+		// The metadata cannot be decoded when a value has a wrong type
+		return metadata, c.problems, fmt.Errorf("%s: invalid metadata", file)
+	}
+	if _, err := toml.Decode(string(data), &metadata); err != nil {
+		return metadata, append(c.problems, Problem{File: file, Message: err.Error()}), err
+	}
+
+	for i, d := range metadata.Dockerfiles {
+		key := fmt.Sprintf("dockerfiles[%d]", i)
+		if d.Path == "" {
+			c.report(key, "%s: missing required key \"path\"", key)
+		}
+		if d.OverwritePolicy != "" {
+			if _, err := layer.ParseOverwritePolicy(string(d.OverwritePolicy)); err != nil {
+				c.report(key+".overwrite_policy", "%s.overwrite_policy: %s", key, err)
+			}
+		}
+		ids := map[string]bool{}
+		for j, secret := range d.Secrets {
+			secretKey := fmt.Sprintf("%s.secrets[%d]", key, j)
+			switch {
+			case secret.ID == "":
+				c.report(secretKey, "%s: missing required key \"id\"", secretKey)
+			case !secretID.MatchString(secret.ID):
+				c.report(secretKey+".id", "%s.id: invalid secret id %q, expected letters, digits, ., _ or -", secretKey, secret.ID)
+			case ids[secret.ID]:
+				c.report(secretKey+".id", "%s.id: duplicate secret %q", secretKey, secret.ID)
+			}
+			ids[secret.ID] = true
+			if (secret.Env == "") == (secret.File == "") {
+				c.report(secretKey, "%s: exactly one of the keys \"env\" and \"file\" is required", secretKey)
+			}
+		}
+		names := map[string]bool{}
+		for j, arg := range d.Args.BuildArg {
+			argKey := fmt.Sprintf("%s.args.build[%d].name", key, j)
+			if names[arg.Key] {
+				c.report(argKey, "%s: duplicate build arg %q", argKey, arg.Key)
+			}
+			names[arg.Key] = true
+		}
+		names = map[string]bool{}
+		for j, arg := range d.Args.RunArg {
+			argKey := fmt.Sprintf("%s.args.run[%d].name", key, j)
+			if names[arg.Key] {
+				c.report(argKey, "%s: duplicate run arg %q", argKey, arg.Key)
+			}
+			names[arg.Key] = true
+		}
+	}
+	return metadata, c.problems, nil
+}
+
+// checker reports the problems of a metadata file at the line of their key
+type checker struct {
+	file       string
+	lines      lineIndex
+	problems   []Problem
+	mismatches int
+}
+
+func (c *checker) report(key string, format string, a ...interface{}) {
+	c.problems = append(c.problems, Problem{File: c.file, Line: c.lines.find(key), Message: fmt.Sprintf(format, a...)})
+}
+
+// checkTable reports the keys of a TOML table which are not fields of the struct type t, or whose value does not have
+// the type of the field
+func (c *checker) checkTable(table map[string]interface{}, t reflect.Type, prefix string) {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name := strings.Split(f.Tag.Get("toml"), ",")[0]; name != "" {
+			fields[name] = f.Type
+		}
+	}
+
+	keys := make([]string, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		ft, ok := fields[k]
+		if !ok {
+			c.report(key, "unknown key %q", key)
+			continue
+		}
+		c.checkValue(table[k], ft, key)
+	}
+}
+
+func (c *checker) checkValue(v interface{}, t reflect.Type, key string) {
+	// An optional value, e.g. build, has the type of the value it points to
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if table, ok := v.(map[string]interface{}); ok {
+			c.checkTable(table, t, key)
+			return
+		}
+	case reflect.Slice:
+		if tables, ok := v.([]map[string]interface{}); ok && t.Elem().Kind() == reflect.Struct {
+			for i, table := range tables {
+				c.checkTable(table, t.Elem(), key+"["+strconv.Itoa(i)+"]")
+			}
+			return
+		}
+		if values, ok := v.([]interface{}); ok {
+			for i, value := range values {
+				c.checkValue(value, t.Elem(), key+"["+strconv.Itoa(i)+"]")
+			}
+			return
+		}
+	case reflect.String:
+		if _, ok := v.(string); ok {
+			return
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); ok {
+			return
+		}
+	}
+	c.mismatches++
+	c.report(key, "%s: expected %s, got %s", key, tomlType(t), tomlValueType(v))
+}
+
+func tomlType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct:
+		return "a table"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Struct {
+			return "an array of tables"
+		}
+		return "an array"
+	case reflect.Bool:
+		return "a boolean"
+	}
+	return "a " + t.Kind().String()
+}
+
+func tomlValueType(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "a table"
+	case []map[string]interface{}:
+		return "an array of tables"
+	case []interface{}:
+		return "an array"
+	case bool:
+		return "a boolean"
+	case int64:
+		return "an integer"
+	case float64:
+		return "a float"
+	case string:
+		return "a string"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+var (
+	secretID    = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	tableHeader = regexp.MustCompile(`^\s*(\[\[?)\s*([^\]]+?)\s*\]\]?`)
+	keyValue    = regexp.MustCompile(`^\s*([A-Za-z0-9_\-."' ]+?)\s*=`)
+)
+
+// lineIndex gives the line of the keys of a TOML document. The elements of the arrays of tables are indexed as in
+// "dockerfiles[1].args.build[0].name"
+type lineIndex map[string]int
+
+func indexLines(data string) lineIndex {
+	index := lineIndex{}
+	counts := map[string]int{}    // number of elements of the arrays of tables, by indexed key
+	arrays := map[string]string{} // last element of the arrays of tables, by key
+	table := ""
+	for n, line := range strings.Split(data, "\n") {
+		if m := tableHeader.FindStringSubmatch(line); m != nil {
+			parts := splitKey(m[2])
+			table = ""
+			for i := range parts {
+				key := strings.Join(parts[:i+1], ".")
+				indexed := parts[i]
+				if table != "" {
+					indexed = table + "." + parts[i]
+				}
+				if i == len(parts)-1 && m[1] == "[[" {
+					// The array itself is located at its first element
+					if _, ok := index[indexed]; !ok {
+						index[indexed] = n + 1
+					}
+					arrays[key] = indexed + "[" + strconv.Itoa(counts[indexed]) + "]"
+					counts[indexed]++
+					indexed = arrays[key]
+				} else if element, ok := arrays[key]; ok {
+					indexed = element
+				}
+				table = indexed
+			}
+			index[table] = n + 1
+			continue
+		}
+		if m := keyValue.FindStringSubmatch(line); m != nil {
+			key := strings.Join(splitKey(m[1]), ".")
+			if table != "" {
+				key = table + "." + key
+			}
+			index[key] = n + 1
+		}
+	}
+	return index
+}
+
+func splitKey(key string) []string {
+	parts := strings.Split(key, ".")
+	for i, p := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(p), `"'`)
+	}
+	return parts
+}
+
+// find returns the line of a key, or of its closest parent when the key is not defined by the document
+func (index lineIndex) find(key string) int {
+	for key != "" {
+		if line, ok := index[key]; ok {
+			return line
+		}
+		i := strings.LastIndexAny(key, ".[")
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+	return 0
+}
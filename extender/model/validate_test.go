@@ -0,0 +1,136 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		problems []string
+		invalid  bool
+	}{
+		{
+			name: "valid",
+			data: `
+[[dockerfiles]]
+extension_id = "sample/curl"
+path = "/layers/curl/Dockerfile"
+build = true
+
+[[dockerfiles.args.build]]
+name = "base_image"
+value = "ubuntu"
+`,
+		},
+		{
+			name: "unknown keys",
+			data: `
+[[args]]
+name = "some_arg"
+
+[[dockerfiles]]
+path = "/layers/curl/Dockerfile"
+
+[[dockerfiles]]
+extention_id = "sample/curl"
+path = "/layers/curl/Dockerfile"
+`,
+			problems: []string{
+				`metadata.toml:2: unknown key "args"`,
+				`metadata.toml:9: unknown key "dockerfiles[1].extention_id"`,
+			},
+		},
+		{
+			name: "wrong types",
+			data: `
+[[dockerfiles]]
+path = "/layers/curl/Dockerfile"
+build = "yes"
+
+[[dockerfiles.args.build]]
+name = 1
+value = "ubuntu"
+`,
+			problems: []string{
+				`metadata.toml:7: dockerfiles[0].args.build[0].name: expected a string, got an integer`,
+				`metadata.toml:4: dockerfiles[0].build: expected a boolean, got a string`,
+			},
+			invalid: true,
+		},
+		{
+			name: "missing path and duplicate args",
+			data: `
+[[dockerfiles]]
+path = "/layers/curl/Dockerfile"
+
+[[dockerfiles]]
+extension_id = "sample/curl"
+
+[[dockerfiles.args.run]]
+name = "some_arg"
+value = "a"
+
+[[dockerfiles.args.run]]
+name = "some_arg"
+value = "b"
+`,
+			problems: []string{
+				`metadata.toml:5: dockerfiles[1]: missing required key "path"`,
+				`metadata.toml:13: dockerfiles[1].args.run[1].name: duplicate run arg "some_arg"`,
+			},
+		},
+		{
+			name: "invalid secrets",
+			data: `
+[[dockerfiles]]
+path = "/layers/npm/Dockerfile"
+
+[[dockerfiles.secrets]]
+id = "npm_token"
+env = "NPM_TOKEN"
+
+[[dockerfiles.secrets]]
+id = "npm_token"
+file = "/platform/secrets/npm_token"
+
+[[dockerfiles.secrets]]
+id = "npm/token"
+env = "NPM_TOKEN"
+file = "/platform/secrets/npm_token"
+
+[[dockerfiles.secrets]]
+env = "NPM_TOKEN"
+`,
+			problems: []string{
+				`metadata.toml:10: dockerfiles[0].secrets[1].id: duplicate secret "npm_token"`,
+				`metadata.toml:14: dockerfiles[0].secrets[2].id: invalid secret id "npm/token"`,
+				`metadata.toml:13: dockerfiles[0].secrets[2]: exactly one of the keys "env" and "file" is required`,
+				`metadata.toml:18: dockerfiles[0].secrets[3]: missing required key "id"`,
+			},
+		},
+		{
+			name:     "syntax error",
+			data:     "[[dockerfiles]]\npath = \"/layers/curl/Dockerfile\n",
+			problems: []string{`metadata.toml:2: toml: line 2`},
+			invalid:  true,
+		},
+	}
+	for _, test := range tests {
+		_, problems, err := DecodeMetadata("metadata.toml", []byte(test.data))
+		if test.invalid != (err != nil) {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if len(problems) != len(test.problems) {
+			t.Errorf("%s: expected %d problem(s), got: %v", test.name, len(test.problems), problems)
+			continue
+		}
+		for i, p := range problems {
+			if !strings.HasPrefix(p.String(), test.problems[i]) {
+				t.Errorf("%s: %q does not start with %q", test.name, p, test.problems[i])
+			}
+		}
+	}
+}
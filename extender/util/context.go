@@ -0,0 +1,19 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const dockerIgnoreFileName = ".dockerignore"
+
+// IgnoreFile returns the ignore file applied to the build context of a Dockerfile: the <Dockerfile>.dockerignore file
+// when it exists, otherwise the .dockerignore file of the context dir. It is empty when there is none
+func IgnoreFile(pathToDockerFile string, contextDir string) string {
+	for _, path := range []string{pathToDockerFile + dockerIgnoreFileName, filepath.Join(contextDir, dockerIgnoreFileName)} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"encoding/json"
+	"github.com/BurntSushi/toml"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExtensionDirName returns the name of the dir where the output of an extension is stored: its ID, or the name of the
+// dir of its Dockerfile when the ID is not defined
+func ExtensionDirName(extensionID string, pathToDockerFile string) string {
+	name := extensionID
+	if name == "" {
+		name = filepath.Base(filepath.Dir(pathToDockerFile))
+	}
+	return strings.ReplaceAll(name, "/", "_")
+}
+
+// WriteJSON stores v, e.g. the description of an extended image, as an indented JSON file
+func WriteJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// LoadExtensionDescriptors decodes the extension.toml file stored next to each Dockerfile, when it exists. The
+// descriptors are returned by Dockerfile path
+func LoadExtensionDescriptors(workspaceDir string, dockerfiles []model.Dockerfile) (map[string]model.ExtensionDescriptor, error) {
+	descriptors := map[string]model.ExtensionDescriptor{}
+	for _, d := range dockerfiles {
+		path := filepath.Join(workspaceDir, filepath.Dir(d.Path), model.ExtensionDescriptorFileName)
+		var descriptor model.ExtensionDescriptor
+		if _, err := toml.DecodeFile(path, &descriptor); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		descriptors[d.Path] = descriptor
+	}
+	return descriptors, nil
+}
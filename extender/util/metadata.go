@@ -0,0 +1,96 @@
+package util
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"os"
+	"path/filepath"
+)
+
+// LoadMetadata decodes a metadata file and returns the problems found. See model.DecodeMetadata
+func LoadMetadata(path string) (model.Metadata, []model.Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return model.Metadata{}, nil, err
+	}
+	return model.DecodeMetadata(path, data)
+}
+
+// LoadLayersDir builds the metadata from the CNB platform layers dir: the extensions of the group file, in order, and
+// the Dockerfiles generated for them under generated/build/<id> and generated/run/<id>. The args of a Dockerfile are
+// read from the build.toml (build args) and launch.toml (run args) files stored next to it. The paths of the Dockerfiles
+// are relative to the workspace dir and their build context is their own dir
+func LoadLayersDir(workspaceDir string, layersDir string, groupFile string) (model.Metadata, error) {
+	var group model.Group
+	if _, err := toml.DecodeFile(groupFile, &group); err != nil {
+		return model.Metadata{}, err
+	}
+	metadata := group.Metadata()
+	for _, e := range group.Extensions {
+		for _, phase := range []model.Phase{model.PhaseBuild, model.PhaseRun} {
+			dir := filepath.Join(layersDir, model.GeneratedDirName, string(phase), ExtensionDirName(e.ID, ""))
+			path := filepath.Join(dir, "Dockerfile")
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return model.Metadata{}, err
+			}
+			relPath, err := filepath.Rel(workspaceDir, path)
+			if err != nil {
+				return model.Metadata{}, err
+			}
+			build, run := phase == model.PhaseBuild, phase == model.PhaseRun
+			d := model.Dockerfile{
+				ExtensionID: e.ID,
+				Path:        relPath,
+				Context:     ".",
+				Build:       &build,
+				Run:         &run,
+			}
+			if d.Args.BuildArg, err = loadArgs(filepath.Join(dir, model.BuildArgsFileName)); err != nil {
+				return model.Metadata{}, err
+			}
+			runArgs, err := loadArgs(filepath.Join(dir, model.LaunchArgsFileName))
+			if err != nil {
+				return model.Metadata{}, err
+			}
+			for _, arg := range runArgs {
+				d.Args.RunArg = append(d.Args.RunArg, model.RunArg(arg))
+			}
+			metadata.Dockerfiles = append(metadata.Dockerfiles, d)
+		}
+	}
+	return metadata, nil
+}
+
+// LoadArgsFile decodes the args of an args file having the format of the build.toml file:
+//
+//	[[args]]
+//	name = "some_arg"
+//	value = "some value"
+func LoadArgsFile(path string) ([]model.ResolvedArg, error) {
+	var file model.ArgsFile
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		return nil, fmt.Errorf("args file %s cannot be decoded: %w", path, err)
+	}
+	var args []model.ResolvedArg
+	for _, arg := range file.Args {
+		if arg.Key == "" {
+			return nil, fmt.Errorf("args file %s: an arg has no name", path)
+		}
+		args = model.SetArg(args, model.ResolvedArg{Name: arg.Key, Value: arg.Value, Source: model.SourceArgsFile})
+	}
+	return args, nil
+}
+
+// loadArgs decodes the args of a build.toml or launch.toml file, when it exists
+func loadArgs(path string) ([]model.BuildArg, error) {
+	var args model.ArgsFile
+	if _, err := toml.DecodeFile(path, &args); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return args.Args, nil
+}
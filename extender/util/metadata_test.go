@@ -0,0 +1,111 @@
+package util
+
+import (
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadLayersDir(t *testing.T) {
+	workspaceDir := t.TempDir()
+	layersDir := filepath.Join(workspaceDir, "layers")
+	writeFile(t, filepath.Join(layersDir, model.GroupFileName), `
+[[group]]
+id = "samples/hello"
+version = "0.0.1"
+api = "0.7"
+
+[[group-extensions]]
+id = "samples/rebasable"
+version = "0.0.1"
+api = "0.7"
+
+[[group-extensions]]
+id = "samples/curl"
+version = "0.0.1"
+api = "0.7"
+`)
+	writeFile(t, filepath.Join(layersDir, "generated/build/samples_curl/Dockerfile"), "FROM ubuntu\n")
+	writeFile(t, filepath.Join(layersDir, "generated/build/samples_curl/build.toml"), "[[args]]\nname = \"some_arg\"\nvalue = \"some-arg-build-value\"\n")
+	writeFile(t, filepath.Join(layersDir, "generated/run/samples_curl/Dockerfile"), "FROM ubuntu\n")
+	writeFile(t, filepath.Join(layersDir, "generated/run/samples_curl/launch.toml"), "[[args]]\nname = \"some_arg\"\nvalue = \"some-arg-launch-value\"\n")
+	writeFile(t, filepath.Join(layersDir, "generated/build/samples_rebasable/Dockerfile"), "FROM ubuntu\n")
+
+	metadata, err := LoadLayersDir(workspaceDir, layersDir, filepath.Join(layersDir, model.GroupFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []model.Dockerfile{
+		{ExtensionID: "samples/rebasable", Path: "layers/generated/build/samples_rebasable/Dockerfile", Context: ".", Build: boolPtr(true), Run: boolPtr(false)},
+		{
+			ExtensionID: "samples/curl",
+			Path:        "layers/generated/build/samples_curl/Dockerfile",
+			Context:     ".",
+			Build:       boolPtr(true),
+			Run:         boolPtr(false),
+			Args:        model.DockerfileArg{BuildArg: []model.BuildArg{{Key: "some_arg", Value: "some-arg-build-value"}}},
+		},
+		{
+			ExtensionID: "samples/curl",
+			Path:        "layers/generated/run/samples_curl/Dockerfile",
+			Context:     ".",
+			Build:       boolPtr(false),
+			Run:         boolPtr(true),
+			Args:        model.DockerfileArg{RunArg: []model.RunArg{{Key: "some_arg", Value: "some-arg-launch-value"}}},
+		},
+	}
+	if !reflect.DeepEqual(expected, metadata.Dockerfiles) {
+		t.Fatalf("\n%#v\n!=\n%#v\n", expected, metadata.Dockerfiles)
+	}
+	if len(metadata.Buildpacks) != 3 || metadata.Buildpacks[0].Extension || !metadata.Buildpacks[1].Extension {
+		t.Fatalf("unexpected buildpacks: %#v", metadata.Buildpacks)
+	}
+	if _, err := metadata.Extensions(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadArgsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "args.toml")
+	writeFile(t, path, `
+[[args]]
+name = "some_arg"
+value = "a=b"
+
+[[args]]
+name = "some_arg"
+value = "c"
+`)
+	args, err := LoadArgsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.ResolvedArg{{Name: "some_arg", Value: "c", Source: model.SourceArgsFile, Overrides: []string{model.SourceArgsFile}}}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("got %v, want %v", args, want)
+	}
+
+	writeFile(t, path, "[[args]]\nvalue = \"x\"\n")
+	if _, err := LoadArgsFile(path); err == nil {
+		t.Error("expected an error for an arg without name")
+	}
+	if _, err := LoadArgsFile(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Error("expected an error for a missing args file")
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
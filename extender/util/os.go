@@ -0,0 +1,14 @@
+package util
+
+import (
+	"fmt"
+	"os"
+)
+
+func GetPWD() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("get current dir failed: %w", err)
+	}
+	return dir, nil
+}
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"fmt"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"os"
+	"path/filepath"
+)
+
+// ReadSecret reads the value of a secret from its env var or its file. A file which does not start with a / is relative
+// to the workspace dir
+func ReadSecret(secret model.Secret, workspaceDir string) ([]byte, error) {
+	if secret.Env != "" {
+		value, ok := os.LookupEnv(secret.Env)
+		if !ok {
+			return nil, fmt.Errorf("secret %s: env var %s is not set", secret.ID, secret.Env)
+		}
+		return []byte(value), nil
+	}
+	path := secret.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workspaceDir, path)
+	}
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: %w", secret.ID, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,38 @@
+package util
+
+import (
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSecret(t *testing.T) {
+	workspaceDir := t.TempDir()
+	writeFile(t, filepath.Join(workspaceDir, "secrets", "token"), "from-file")
+	os.Setenv("TEST_SECRET_TOKEN", "from-env")
+	defer os.Unsetenv("TEST_SECRET_TOKEN")
+
+	tests := []struct {
+		secret model.Secret
+		value  string
+	}{
+		{secret: model.Secret{ID: "env", Env: "TEST_SECRET_TOKEN"}, value: "from-env"},
+		{secret: model.Secret{ID: "relative", File: "secrets/token"}, value: "from-file"},
+		{secret: model.Secret{ID: "absolute", File: filepath.Join(workspaceDir, "secrets", "token")}, value: "from-file"},
+	}
+	for _, test := range tests {
+		value, err := ReadSecret(test.secret, workspaceDir)
+		if err != nil {
+			t.Errorf("%s: %v", test.secret.ID, err)
+		} else if string(value) != test.value {
+			t.Errorf("%s: got %q, want %q", test.secret.ID, value, test.value)
+		}
+	}
+
+	for _, secret := range []model.Secret{{ID: "unset", Env: "TEST_SECRET_UNSET"}, {ID: "missing", File: "missing"}} {
+		if _, err := ReadSecret(secret, workspaceDir); err == nil {
+			t.Errorf("%s: expected an error", secret.ID)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FindFiles searches the files under the root dir and returns their paths. The ignore paths are absolute paths of the
+// root dir, e.g. /proc, whose content is not searched
+func FindFiles(root string, filesToSearch []string, ignorePaths []string) ([]string, error) {
+	var files []string
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			logrus.Warnf("%s cannot be searched: %v", path, err)
+			return nil
+		}
+		if info.IsDir() && ignored(root, path, ignorePaths) {
+			logrus.Debugf("Ignored path: %s", path)
+			return filepath.SkipDir
+		}
+
+		for _, s := range filesToSearch {
+			logrus.Tracef("File searched is : %s", info.Name())
+			if !info.IsDir() && info.Name() == s {
+				files = append(files, path)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		logrus.Infof("File found: %s", file)
+	}
+	return files, nil
+}
+
+// ignored returns true when the path of the root dir is one of the ignore paths or is under one of them
+func ignored(root, path string, ignorePaths []string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.Join("/", rel)
+	for _, p := range ignorePaths {
+		if p == "" {
+			continue
+		}
+		p = filepath.Join("/", p)
+		if rel == p || strings.HasPrefix(rel, p+"/") {
+			return true
+		}
+	}
+	return false
+}
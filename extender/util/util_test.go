@@ -0,0 +1,23 @@
+package util
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "usr", "bin", "curl"), "")
+	writeFile(t, filepath.Join(root, "proc", "1", "curl"), "")
+	writeFile(t, filepath.Join(root, "processes", "curl"), "")
+
+	files, err := FindFiles(root, []string{"curl", "wget"}, []string{"/proc", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(root, "processes", "curl"), filepath.Join(root, "usr", "bin", "curl")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got %v, want %v", files, want)
+	}
+}
@@ -1,175 +1,179 @@
 package buildpackconfig
 
 import (
-	"archive/tar"
-	"compress/gzip"
-	"encoding/json"
-	"errors"
+	"fmt"
 	"github.com/GoogleContainerTools/kaniko/pkg/config"
 	"github.com/GoogleContainerTools/kaniko/pkg/dockerfile"
 	"github.com/GoogleContainerTools/kaniko/pkg/executor"
 	image_util "github.com/GoogleContainerTools/kaniko/pkg/image"
+	"github.com/GoogleContainerTools/kaniko/pkg/image/remote"
 	fs_util "github.com/GoogleContainerTools/kaniko/pkg/util"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/tarball"
-	"github.com/redhat-buildpacks/poc/kaniko/store"
-	"github.com/redhat-buildpacks/poc/kaniko/util"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/redhat-buildpacks/poc/extender/extract"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/extender/util"
+	"github.com/redhat-buildpacks/poc/layer"
 	"github.com/sirupsen/logrus"
-	"io"
-	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
-	"strings"
-	"time"
 )
 
 const (
-	homeDir                   = "/"
-	kanikoDir                 = "/kaniko"
-	cacheDir                  = "/cache"
-	workspaceDir              = "/workspace"
-	defaultDockerFileName     = "Dockerfile"
-	layerTarFileName          = "newlayer.tar"
-	destination               = "new_image"
-	DOCKER_FILE_NAME_ENV_NAME = "DOCKER_FILE_NAME"
-	IGNORE_PATHS_ENV_NAME     = "IGNORE_PATHS"
+	homeDir                = "/"
+	cacheDir               = "/cache"
+	workspaceDir           = "/workspace"
+	defaultDockerFileName  = "Dockerfile"
+	destination            = "new_image"
+	chainedImageRepository = "cnb-extension"
 )
 
 var ignorePaths = []string{""}
 
 type BuildPackConfig struct {
-	LayerPath      string
-	CacheDir       string
-	Destination    string
-	KanikoDir      string
-	WorkspaceDir   string
-	DockerFileName string
-	Opts           config.KanikoOptions
-	NewImage       v1.Image
-	BuildArgs      []string
-	CnbEnvVars     map[string]string
-	TarPaths         []store.TarFile
-	LayerTarFileName string
-	HomeDir          string
-	ExtractLayers  bool
-	IgnorePaths    []string
-	FilesToSearch  []string
+	CacheDir      string
+	Destination   string
+	KanikoDir     string
+	WorkspaceDir  string
+	Opts          config.KanikoOptions
+	NewImage      v1.Image
+	HomeDir       string
+	SecretsDir    string
+	chainedImages map[string]v1.Image
+	IgnorePaths   []string
 }
 
 func NewBuildPackConfig() *BuildPackConfig {
 	return &BuildPackConfig{
-		LayerPath:        "",
-		CacheDir:         cacheDir,
-		WorkspaceDir:     workspaceDir,
-		KanikoDir:        kanikoDir,
-		HomeDir:          homeDir,
-		LayerTarFileName: layerTarFileName,
-		Destination:      destination,
+		CacheDir:     cacheDir,
+		WorkspaceDir: workspaceDir,
+		KanikoDir:    config.KanikoDir,
+		HomeDir:      homeDir,
+		Destination:  destination,
+		SecretsDir:   model.SecretsDir,
 	}
 }
 
 func (b *BuildPackConfig) InitDefaults() {
 
-	logrus.Debug("Check if DOCKER_FILE_NAME env is defined...")
-	b.DockerFileName = util.GetValFromEnVar(DOCKER_FILE_NAME_ENV_NAME)
-	if b.DockerFileName == "" {
-		b.DockerFileName = defaultDockerFileName
-	}
-	logrus.Debugf("DockerfileName is: %s", b.DockerFileName)
-
-	logrus.Debug("Check if IGNORE_PATHS env is defined...")
-
-	result := util.GetValFromEnVar(IGNORE_PATHS_ENV_NAME)
-	if result == "" {
+	if len(b.IgnorePaths) == 0 {
 		b.IgnorePaths = ignorePaths
-	} else {
-		b.IgnorePaths = strings.Split(result, ",")
 	}
 	logrus.Debugf("Additional paths to be ignored: %s", b.IgnorePaths)
-	for _, p := range b.IgnorePaths {
+	// The snapshots and stages of kaniko are stored under its dir, which is ignored as the default one
+	if b.KanikoDir != config.KanikoDir {
+		config.KanikoDir = b.KanikoDir
+		b.IgnorePaths = append(b.IgnorePaths, b.KanikoDir)
+	}
+	// The secrets mounted for the RUN instructions must never be part of the layers
+	for _, p := range append([]string{b.SecretsDir}, b.IgnorePaths...) {
 		fs_util.AddToDefaultIgnoreList(fs_util.IgnoreListEntry{
 			Path:            p,
 			PrefixMatchOnly: false,
 		})
 	}
 
-	logrus.Debug("Checking if CNB_* env var have been declared ...")
-	b.CnbEnvVars = util.GetCNBEnvVar()
-	logrus.Debugf("CNB ENV var is: %s", b.CnbEnvVars)
-
-	// Convert the CNB ENV vars to Kaniko BuildArgs
-	for k, v := range b.CnbEnvVars {
-		logrus.Debugf("CNB env key: %s, value: %s", k, v)
-		arg := k + "=" + v
-		b.BuildArgs = append(b.BuildArgs, arg)
-	}
-
 	// setup the path to access the Dockerfile within the workspace dir
-	dockerFilePath := b.WorkspaceDir + "/" + b.DockerFileName
+	dockerFilePath := b.WorkspaceDir + "/" + defaultDockerFileName
 
 	// init the Kaniko options
 	b.Opts = config.KanikoOptions{
-		CacheOptions:   config.CacheOptions{CacheDir: cacheDir},
-		DockerfilePath: dockerFilePath,
-		IgnoreVarRun:   true,
-		NoPush:         true,
-		SrcContext:     b.WorkspaceDir,
-		SnapshotMode:   "full",
-		BuildArgs:      b.BuildArgs,
-		IgnorePaths:    b.IgnorePaths,
-		TarPath:        b.LayerTarFileName,
-		Destinations:   []string{b.Destination},
+		CacheOptions:       config.CacheOptions{CacheDir: b.CacheDir},
+		DockerfilePath:     dockerFilePath,
+		IgnoreVarRun:       true,
+		NoPush:             true,
+		SrcContext:         b.WorkspaceDir,
+		SnapshotMode:       "full",
+		IgnorePaths:        b.IgnorePaths,
+		Destinations:       []string{b.Destination},
 		ForceBuildMetadata: true,
 	}
 
 	logrus.Debug("KanikoOptions defined")
 }
 
-func (b *BuildPackConfig) ProcessDockerfile(pathToDockerFile string) {
-	// Launch a timer to measure the time needed to parse/copy/extract
-	start := time.Now()
-
-	// Build the Dockerfile
-	b.Opts.DockerfilePath = pathToDockerFile
-	logrus.Infof("Building the %s", b.Opts.DockerfilePath)
-	err := b.BuildDockerFile()
-	if err != nil {
-		panic(err)
+// SetBuildContext sets the build context dir of the next Dockerfile to be built. The files excluded by the ignore file of
+// the Dockerfile or of the context dir are not part of the context
+func (b *BuildPackConfig) SetBuildContext(pathToDockerFile string, contextDir string) error {
+	if _, err := os.Stat(contextDir); err != nil {
+		return fmt.Errorf("build context of the Dockerfile %s: %w", pathToDockerFile, err)
 	}
-
-	// Log the content of the Kaniko dir
-	logrus.Infof("Reading dir content of: %s", b.KanikoDir)
-	util.ReadFilesFromPath(b.KanikoDir)
-
-	// Copy the tgz layer file to the Cache dir
-	srcPath := path.Join("/", b.LayerTarFileName)
-	dstPath := path.Join(b.CacheDir, b.LayerTarFileName)
-	logrus.Infof("Copy the %s file to the %s dir ...", srcPath, dstPath)
-	err = util.File(srcPath, dstPath)
-	if (err != nil) {
-		panic(err)
+	b.Opts.SrcContext = contextDir
+	logrus.Infof("Build context: %s", contextDir)
+	if ignoreFile := util.IgnoreFile(pathToDockerFile, contextDir); ignoreFile != "" {
+		logrus.Infof("Files excluded from the build context listed in %s", ignoreFile)
 	}
+	return nil
+}
 
-	logrus.Infof("Extract the content of the tarball file %s under the cache %s",b.Opts.TarPath,b.Opts.CacheDir)
-	b.ExtractImageTarFile(dstPath)
-	logrus.Info("Extract the layer file(s)")
-	descriptor, err := b.LoadDescriptorAndConfig()
-	if (err != nil) {
-		panic(err)
+// MountSecrets writes the secrets of the next Dockerfile to be built under the secrets dir, where its RUN instructions
+// find them as with RUN --mount=type=secret,id=<id>. The secrets dir is ignored by the snapshots of Kaniko: the secrets
+// are not part of the layers of the image. The returned func removes them. When a secret cannot be mounted, the secrets
+// already mounted are removed
+func (b *BuildPackConfig) MountSecrets(secrets []model.Secret) (func(), error) {
+	var paths []string
+	unmount := func() {
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				logrus.Warnf("Secret %s not removed: %s", path, err)
+			}
+		}
 	}
+	for _, secret := range secrets {
+		path, err := b.mountSecret(secret)
+		if err != nil {
+			unmount()
+			return nil, err
+		}
+		paths = append(paths, path)
+		logrus.Infof("Secret %s mounted at %s", secret.ID, path)
+	}
+	return unmount, nil
+}
 
-	logrus.Infof("%+v\n", descriptor)
-	layers := descriptor[0].Layers
-	b.ExtractTarGZFilesWithoutBaseImage(layers[0])
+// mountSecret writes the secret under the secrets dir and returns its path
+func (b *BuildPackConfig) mountSecret(secret model.Secret) (string, error) {
+	value, err := util.ReadSecret(secret, b.WorkspaceDir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(b.SecretsDir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(b.SecretsDir, secret.ID)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err := os.WriteFile(path, value, 0400); err != nil {
+		return "", fmt.Errorf("secret %s cannot be written: %w", secret.ID, err)
+	}
+	return path, nil
+}
 
-	// Check if files exist
-	if (len(b.FilesToSearch) > 0) {
-		util.FindFiles(b.FilesToSearch)
+// ChainImage registers the image produced by an extension in order to use it as base_image of the next one and returns
+// its reference. The registered images are resolved locally instead of being pulled
+func (b *BuildPackConfig) ChainImage(img v1.Image) (string, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return "", err
 	}
+	if b.chainedImages == nil {
+		b.chainedImages = map[string]v1.Image{}
+		image_util.RetrieveRemoteImage = b.retrieveRemoteImage
+	}
+	ref := chainedImageRepository + "@" + digest.String()
+	b.chainedImages[ref] = img
+	return ref, nil
+}
 
-	// Time elapsed is ...
-	logrus.Infof("Time elapsed: %s",time.Since(start))
+// retrieveRemoteImage returns the chained image matching the reference or pulls the image
+func (b *BuildPackConfig) retrieveRemoteImage(image string, opts config.RegistryOptions, customPlatform string) (v1.Image, error) {
+	if img, ok := b.chainedImages[image]; ok {
+		logrus.Infof("Image %s produced by the previous extension", image)
+		return img, nil
+	}
+	return remote.RetrieveRemoteImage(image, opts, customPlatform)
 }
 
 func (b *BuildPackConfig) BuildDockerFile() (err error) {
@@ -177,259 +181,130 @@ func (b *BuildPackConfig) BuildDockerFile() (err error) {
 	// If we look to the Kaniko code, they are moving under the root dire directory
 	logrus.Info("Moving to root dir")
 	if err := os.Chdir("/"); err != nil {
-		panic(err)
+		return err
 	}
 
-	logrus.Debugf("Options used %+v", b.Opts)
+	// The options are not logged as their build args can contain secrets
 	b.NewImage, err = executor.DoBuild(&b.Opts)
-	if (err != nil) {
+	if err != nil {
 		return err
 	}
 
 	// Push the image to its destination
 	logrus.Info("Push the image to its destination")
 	err = executor.DoPush(b.NewImage, &b.Opts)
-    return err
+	return err
 }
 
-func (b *BuildPackConfig) ExtractLayersFromNewImageToKanikoDir() {
-	// Get layers
-	layers, err := b.NewImage.Layers()
+// FindBaseImageDiffIDs returns the diffIDs of the layers of the base image used by the last stage of the Dockerfile
+func (b *BuildPackConfig) FindBaseImageDiffIDs() ([]string, error) {
+	stages, metaArgs, err := dockerfile.ParseStages(&b.Opts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	logrus.Infof("Generated %d layers", len(layers))
-
-	tarFiles := []store.TarFile{}
-
-	for _, layer := range layers {
-		digest, err := layer.Digest()
-		digest.MarshalText()
-		if err != nil {
-			panic(err)
-		}
 
-		tarFile := store.TarFile{
-			Name: digest.String(),
-			Path: filepath.Join(b.KanikoDir, digest.String()+".tgz"),
-		}
-		logrus.Infof("Tar layer file: %s", tarFile.Path)
-
-		// Add the tgz file to the list of the tgz files
-		tarFiles = append(tarFiles, tarFile)
-
-		// Save the tgz layer file within the Kaniko dir
-		err = saveLayer(layer, tarFile.Path)
-		if err != nil {
-			panic(err)
-		}
-	}
-	b.TarPaths = tarFiles
-}
-
-func (b *BuildPackConfig) ExtractImageTarFile(destinationTarPath string) {
-	logrus.Infof("Untar the Image Tar File to %s",destinationTarPath)
-	err := b.untar(destinationTarPath, b.Opts.CacheDir,false)
+	kanikoStages, err := dockerfile.MakeKanikoStages(&b.Opts, stages, metaArgs)
 	if err != nil {
-		panic(err)
-	}
-}
-
-func (b *BuildPackConfig) ExtractTarGZFilesWithoutBaseImage(baseTarGzipFile string) {
-	fullPath := path.Join(b.Opts.CacheDir,baseTarGzipFile)
-	for _, f := range util.FilterFiles(b.Opts.CacheDir, ".gz") {
-		if f != fullPath {
-			logrus.Infof("Tgz file to be extracted %s", f)
-			err := b.untar(f, b.Opts.CacheDir, true)
-			if err != nil {
-				panic(err)
-			}
-		}
+		return nil, err
 	}
-}
-
-func (b *BuildPackConfig) CopyTGZFilesToCacheDir() {
-	// Copy the content of the kanikoDir to the cacheDir
-	util.Dir(b.KanikoDir, b.CacheDir)
-}
-
-func (b *BuildPackConfig) SaveImageRawManifest() {
-	rawManifest, err := b.NewImage.RawManifest()
-	rawManifestFilePath := b.CacheDir + "/manifest.json"
-	err = ioutil.WriteFile(rawManifestFilePath, rawManifest, 0644)
-	if err != nil {
-		panic(err)
+	if len(kanikoStages) == 0 {
+		return nil, fmt.Errorf("no stage found in %s", b.Opts.DockerfilePath)
 	}
-	logrus.Debugf("Manifest file of the new image stored at %s", rawManifestFilePath)
-}
 
-func (b *BuildPackConfig) SaveImageJSONConfig() {
-	// Get the Image config file
-	configJSON, err := b.NewImage.ConfigFile()
-	if err != nil {
-		panic(err)
-	}
-	configPath := filepath.Join(b.KanikoDir, "config.json")
-	c, err := os.Create(configPath)
-	if err != nil {
-		panic(err)
+	// The image built is the one of the last stage. A stage built from a previous one shares its base image
+	kanikoStage := kanikoStages[len(kanikoStages)-1]
+	for kanikoStage.BaseImageStoredLocally {
+		kanikoStage = kanikoStages[kanikoStage.BaseImageIndex]
 	}
-	defer c.Close()
+	logrus.Infof("Kaniko stage is: %s, index: %d", kanikoStage.BaseName, kanikoStage.Index)
 
-	err = json.NewEncoder(c).Encode(*configJSON)
+	// Retrieve the SourceImage
+	baseImage, err := image_util.RetrieveSourceImage(kanikoStage, &b.Opts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	logrus.Debugf("Image JSON config file stored at %s", configPath)
 
-	// Log the image json config
-	// TODO: Add a debug opt to log if needed
-	// readFileContent(c)
-}
-
-func (b *BuildPackConfig) untar(tarFilePath string, targetDir string, isGzip bool) (err error) {
-	var gzr io.Reader
-	// Try first to open the file
-	f, err := os.Open(tarFilePath)
+	// Get the layers of the Base Image
+	layers, err := baseImage.Layers()
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	logrus.Infof("Creating a reader for: %s", f.Name())
-	if isGzip {
-		gzr, err = gzip.NewReader(f)
+	var diffIDs []string
+	for _, l := range layers {
+		diffID, err := l.DiffID()
 		if err != nil {
-			return err
+			return nil, err
 		}
-	} else {
-		gzr = f
+		logrus.Infof("Layer diffID of base image is: %s", diffID)
+		diffIDs = append(diffIDs, diffID.String())
 	}
-
-	tr := tar.NewReader(gzr)
-	// Get each tar segment
-	for true {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			logrus.Infof("ExtractTarGz: Next() failed: %v", err)
-		}
-
-		// the target location where the dir/file should be created
-		target := filepath.Join(targetDir, hdr.Name)
-		logrus.Debugf("File to be extracted: %s", target)
-
-		if b.ExtractLayers {
-			switch hdr.Typeflag {
-			case tar.TypeDir:
-				if _, err := os.Stat(target); err != nil {
-					// TODO: Should we define a const for the permission
-					if err := os.Mkdir(target, 0755); err != nil {
-						logrus.Fatalf("ExtractTarGz: Mkdir() failed: %s", err.Error())
-						return err
-					}
-				}
-			case tar.TypeReg:
-				pathExists := util.FileExists(target)
-				if pathExists {
-					logrus.Debugf("ExtractTarGz: %s exists: %t\n", target, pathExists)
-				} else {
-					outFile, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(hdr.Mode))
-					if err != nil {
-						logrus.Fatalf("ExtractTarGz: Create() failed: %s", err.Error())
-						return err
-					}
-					if _, err := io.Copy(outFile, tr); err != nil {
-						logrus.Fatalf("ExtractTarGz: Copy() failed: %s", err.Error())
-						return err
-					}
-					// manually close here after each file operation; defering would cause each file close
-					// to wait until all operations have completed.
-					logrus.Debugf("File extracted to %s", outFile.Name())
-					outFile.Close()
-				}
-
-			default:
-				logrus.Debugf(
-					"ExtractTarGz: unknown type: %c in %s",
-					hdr.Typeflag,
-					hdr.Name)
-			}
-		}
-
-	}
-	return nil
+	return diffIDs, nil
 }
 
-func (b *BuildPackConfig) FindBaseImageDigest() v1.Hash {
-	var digest v1.Hash
-
-	stages, metaArgs, err := dockerfile.ParseStages(&b.Opts)
-	if err != nil {
-		panic(err)
+// writeLayout stores the image as an OCI layout under layoutDir and returns the digest of its manifest
+func writeLayout(img v1.Image, layoutDir string) (string, error) {
+	if err := os.RemoveAll(layoutDir); err != nil {
+		return "", err
 	}
-
-	kanikoStages, err := dockerfile.MakeKanikoStages(&b.Opts, stages, metaArgs)
+	p, err := layout.Write(layoutDir, empty.Index)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-
-	// Check the baseImage and Log the layer digest
-	for _, kanikoStage := range kanikoStages {
-		var baseImage v1.Image
-		logrus.Infof("Kaniko stage is: %s, index: %d", kanikoStage.BaseName, kanikoStage.Index)
-
-		// Retrieve the SourceImage
-		baseImage, err = image_util.RetrieveSourceImage(kanikoStage, &b.Opts)
-
-		// Get the layers of the Base Image
-		layers, err := baseImage.Layers()
-		if err != nil {
-			panic(err)
-		}
-		for _, l := range layers {
-			digest, err = l.Digest()
-			if err != nil {
-				panic(err)
-			}
-			logrus.Infof("Layer digest of base image is: %s", digest)
-		}
+	if err := p.AppendImage(img); err != nil {
+		return "", err
 	}
-	return digest
-}
-
-func (b *BuildPackConfig) LoadDescriptorAndConfig() (tarball.Manifest, error) {
-	var m tarball.Manifest
-	f, err := os.Open(path.Join(b.Opts.CacheDir,"manifest.json"))
+	digest, err := img.Digest()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return digest.String(), nil
+}
 
-	if err := json.NewDecoder(f).Decode(&m); err != nil {
+// newLayers returns, in order, the layers of the image whose diffID does not belong to the base image. Their
+// uncompressed content is streamed from the image when they are extracted, nothing is copied to the cache dir
+func newLayers(img v1.Image, baseDiffIDs []string) ([]extract.Layer, error) {
+	imageLayers, err := img.Layers()
+	if err != nil {
 		return nil, err
 	}
-
-	if &m == nil {
-		return nil, errors.New("no valid manifest.json in tarball")
+	var diffIDs []string
+	for _, l := range imageLayers {
+		diffID, err := l.DiffID()
+		if err != nil {
+			return nil, err
+		}
+		diffIDs = append(diffIDs, diffID.String())
 	}
 
-	return m, nil
-}
-
-func saveLayer(layer v1.Layer, path string) error {
-	layerReader, err := layer.Compressed()
+	indexes, err := layer.NewLayers(diffIDs, baseDiffIDs)
 	if err != nil {
-		return err
-	}
-	l, err := os.Create(path)
-	if err != nil {
-		return err
+		return nil, err
 	}
-	defer l.Close()
-	_, err = io.Copy(l, layerReader)
-	if err != nil {
-		return err
+	var layers []extract.Layer
+	for _, i := range indexes {
+		l := imageLayers[i]
+		digest, err := l.Digest()
+		if err != nil {
+			return nil, err
+		}
+		mediaType, err := l.MediaType()
+		if err != nil {
+			return nil, err
+		}
+		size, err := l.Size()
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, extract.Layer{
+			ExtendedLayer: model.ExtendedLayer{
+				Digest:    digest.String(),
+				DiffID:    diffIDs[i],
+				MediaType: string(mediaType),
+				Size:      size,
+			},
+			Open: l.Uncompressed,
+		})
 	}
-	return nil
+	logrus.Infof("%d new layer(s) out of %d", len(layers), len(imageLayers))
+	return layers, nil
 }
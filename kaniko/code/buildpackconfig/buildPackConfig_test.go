@@ -0,0 +1,183 @@
+package buildpackconfig
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleContainerTools/kaniko/pkg/config"
+	image_util "github.com/GoogleContainerTools/kaniko/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/redhat-buildpacks/poc/extender/extract"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/redhat-buildpacks/poc/layer/layertest"
+)
+
+// newImageLayer returns a layer of an image containing the entries
+func newImageLayer(t *testing.T, entries []layertest.Entry) v1.Layer {
+	data, err := io.ReadAll(layertest.NewLayer(t, entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestNewLayers(t *testing.T) {
+	root := t.TempDir()
+	base := []v1.Layer{
+		newImageLayer(t, []layertest.Entry{{Name: "base.txt", Typeflag: tar.TypeReg, Body: "base"}}),
+		newImageLayer(t, []layertest.Entry{{Name: "lib/", Typeflag: tar.TypeDir}, {Name: "lib/base.so", Typeflag: tar.TypeReg, Body: "base"}}),
+	}
+	img, err := mutate.AppendLayers(empty.Image, append(base,
+		newImageLayer(t, []layertest.Entry{{Name: "etc/", Typeflag: tar.TypeDir}, {Name: "etc/new.txt", Typeflag: tar.TypeReg, Body: "new"}}),
+		newImageLayer(t, []layertest.Entry{{Name: "etc/.wh.new.txt", Typeflag: tar.TypeReg}, {Name: "etc/last.txt", Typeflag: tar.TypeReg, Body: "last"}}),
+	)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var baseDiffIDs []string
+	for _, l := range base {
+		diffID, err := l.DiffID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		baseDiffIDs = append(baseDiffIDs, diffID.String())
+	}
+
+	layers, err := newLayers(img, baseDiffIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 2 {
+		t.Fatalf("expected the 2 layers which are not part of the base image, got %+v", layers)
+	}
+	e := &extract.Extractor{
+		Extract:     true,
+		RootFSDir:   root,
+		JournalFile: filepath.Join(t.TempDir(), "journal.json"),
+	}
+	e.JournalBackupDir = filepath.Join(filepath.Dir(e.JournalFile), "journal")
+	if err := e.Apply(layers); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"base.txt", "lib"} {
+		if _, err := os.Lstat(filepath.Join(root, p)); !os.IsNotExist(err) {
+			t.Errorf("%s of the base image has been extracted: %v", p, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(root, "etc", "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("etc/new.txt should have been removed by the last layer: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(root, "etc", "last.txt")); string(content) != "last" {
+		t.Errorf("etc/last.txt not extracted, got %q", content)
+	}
+}
+
+func TestWriteLayout(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image, newImageLayer(t, []layertest.Entry{{Name: "opt/", Typeflag: tar.TypeDir}, {Name: "opt/arg.txt", Typeflag: tar.TypeReg, Body: "run"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layoutDir := filepath.Join(t.TempDir(), "image")
+	digest, err := writeLayout(img, layoutDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := layout.ImageIndexFromPath(layoutDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Manifests) != 1 || manifest.Manifests[0].Digest.String() != digest {
+		t.Errorf("expected the image %s in the OCI layout, got %+v", digest, manifest.Manifests)
+	}
+}
+
+func TestMountSecrets(t *testing.T) {
+	b := NewBuildPackConfig()
+	b.WorkspaceDir = t.TempDir()
+	b.SecretsDir = filepath.Join(t.TempDir(), "secrets")
+	if err := os.WriteFile(filepath.Join(b.WorkspaceDir, "token"), []byte("from-file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TEST_MOUNT_SECRET", "from-env")
+	defer os.Unsetenv("TEST_MOUNT_SECRET")
+
+	unmount, err := b.MountSecrets([]model.Secret{{ID: "file", File: "token"}, {ID: "env", Env: "TEST_MOUNT_SECRET"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]string{"file": "from-file", "env": "from-env"} {
+		got, err := os.ReadFile(filepath.Join(b.SecretsDir, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("secret %s: got %q, want %q", id, got, want)
+		}
+	}
+	unmount()
+	if entries, _ := os.ReadDir(b.SecretsDir); len(entries) != 0 {
+		t.Errorf("secrets not removed: %v", entries)
+	}
+
+	// The secrets already mounted are removed when a secret cannot be read
+	if _, err := b.MountSecrets([]model.Secret{{ID: "file", File: "token"}, {ID: "missing", File: "missing"}}); err == nil {
+		t.Error("expected an error for a missing secret file")
+	}
+	if entries, _ := os.ReadDir(b.SecretsDir); len(entries) != 0 {
+		t.Errorf("secrets not removed after the error: %v", entries)
+	}
+}
+
+func TestChainImage(t *testing.T) {
+	retrieveRemoteImage := image_util.RetrieveRemoteImage
+	defer func() {
+		image_util.RetrieveRemoteImage = retrieveRemoteImage
+	}()
+
+	img, err := mutate.AppendLayers(empty.Image, newImageLayer(t, []layertest.Entry{{Name: "opt/", Typeflag: tar.TypeDir}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBuildPackConfig()
+	ref, err := b.ChainImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != "cnb-extension@"+digest.String() {
+		t.Errorf("unexpected reference %s", ref)
+	}
+
+	// The next Dockerfile gets the chained image as base image instead of pulling it
+	got, err := image_util.RetrieveRemoteImage(ref, config.RegistryOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != img {
+		t.Errorf("expected the chained image %s", ref)
+	}
+}
@@ -0,0 +1,30 @@
+package buildpackconfig
+
+import (
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"os"
+	"strings"
+)
+
+// ParseDockerfile parses the instructions of a Dockerfile using the parser of kaniko
+func ParseDockerfile(path string) ([]model.Instruction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	result, err := parser.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	var instructions []model.Instruction
+	for _, node := range result.AST.Children {
+		i := model.Instruction{Line: node.StartLine, Name: strings.ToUpper(node.Value), Flags: node.Flags, Original: node.Original}
+		for next := node.Next; next != nil; next = next.Next {
+			i.Args = append(i.Args, next.Value)
+		}
+		instructions = append(instructions, i)
+	}
+	return instructions, nil
+}
@@ -0,0 +1,73 @@
+package buildpackconfig
+
+import (
+	"github.com/redhat-buildpacks/poc/extender/config"
+	"github.com/redhat-buildpacks/poc/extender/engine"
+	"github.com/redhat-buildpacks/poc/extender/failure"
+	"github.com/redhat-buildpacks/poc/extender/model"
+	"github.com/sirupsen/logrus"
+)
+
+// EngineName is the name of the kaniko engine, e.g. ENGINE=kaniko
+const EngineName = "kaniko"
+
+// New creates the kaniko engine building the Dockerfiles of the workspace dir of the config
+func New(c *config.Config) (engine.Engine, error) {
+	b := NewBuildPackConfig()
+	b.WorkspaceDir = c.WorkspaceDir
+	b.CacheDir = c.CacheDir
+	b.IgnorePaths = c.IgnorePaths
+	b.KanikoDir = c.KanikoDir
+	b.InitDefaults()
+	logrus.Infof("Kaniko      dir: %s", b.KanikoDir)
+	return b, nil
+}
+
+// Name returns the name of the engine
+func (b *BuildPackConfig) Name() string {
+	return EngineName
+}
+
+// ParseDockerfile parses the instructions of a Dockerfile using the parser of kaniko
+func (b *BuildPackConfig) ParseDockerfile(path string) ([]model.Instruction, error) {
+	return ParseDockerfile(path)
+}
+
+// Build builds the Dockerfile and returns the new layers of the image. The image is registered to be used as
+// base_image by the next Dockerfile, which gets it without pulling it. The errors are categorized by the step which
+// failed: build, pull of the base image or export of the new layers
+func (b *BuildPackConfig) Build(req engine.Request) (engine.Image, error) {
+	if err := b.SetBuildContext(req.Dockerfile, req.ContextDir); err != nil {
+		return engine.Image{}, failure.Wrap(failure.Metadata, err)
+	}
+	unmountSecrets, err := b.MountSecrets(req.Secrets)
+	if err != nil {
+		return engine.Image{}, failure.Wrap(failure.Build, err)
+	}
+	defer unmountSecrets()
+
+	b.Opts.BuildArgs = model.ArgStrings(req.Args)
+	b.Opts.DockerfilePath = req.Dockerfile
+	logrus.Infof("Building the %s", b.Opts.DockerfilePath)
+	if err := b.BuildDockerFile(); err != nil {
+		return engine.Image{}, failure.Wrap(failure.Build, err)
+	}
+
+	baseDiffIDs, err := b.FindBaseImageDiffIDs()
+	if err != nil {
+		return engine.Image{}, failure.Wrapf(failure.Pull, err, "base image of the Dockerfile %s", req.Dockerfile)
+	}
+	var img engine.Image
+	if img.Layers, err = newLayers(b.NewImage, baseDiffIDs); err != nil {
+		return engine.Image{}, failure.Wrap(failure.Export, err)
+	}
+	if req.Layout != "" {
+		if img.Digest, err = writeLayout(b.NewImage, req.Layout); err != nil {
+			return engine.Image{}, failure.Wrapf(failure.Export, err, "OCI layout %s", req.Layout)
+		}
+	}
+	if img.Reference, err = b.ChainImage(b.NewImage); err != nil {
+		return engine.Image{}, failure.Wrap(failure.Export, err)
+	}
+	return img, nil
+}
@@ -1,5 +0,0 @@
-package model
-
-type Metadata struct {
-	Dockerfiles []Dockerfile
-}
\ No newline at end of file
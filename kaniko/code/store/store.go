@@ -1,6 +0,0 @@
-package store
-
-type TarFile struct {
-	Name	string
-	Path    string
-}
@@ -1,24 +1,23 @@
 package test
 
 import (
-	cfg "github.com/redhat-buildpacks/poc/kaniko/buildpackconfig"
-	"github.com/redhat-buildpacks/poc/kaniko/util"
+	"github.com/redhat-buildpacks/poc/extender/model"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
 )
 
 var envTests = []struct {
-	name				string
-	envKey              string
-	envVal              string
-	expectedBuildArgs   []string
+	name              string
+	envKey            string
+	envVal            string
+	expectedBuildArgs []string
 }{
 	{
-		name:             "CNB foo and bar key, val",
-		envKey:           "CNB_foo",
-		envVal: 		  "bar",
-		expectedBuildArgs:   []string{"CNB_foo=bar"},
+		name:              "CNB foo and bar key, val",
+		envKey:            "CNB_foo",
+		envVal:            "bar",
+		expectedBuildArgs: []string{"CNB_foo=bar"},
 	},
 }
 
@@ -26,7 +25,7 @@ var envTests = []struct {
 // ../vendor/github.com/docker/docker/builder/dockerfile/internals.go:193:19: undefined: parseChownFlag
 func TestEnvToBuildArgs(t *testing.T) {
 
-	b := cfg.NewBuildPackConfig()
+	var sources model.ArgSources
 
 	for _, test := range envTests {
 		t.Run(test.name, func(t *testing.T) {
@@ -35,9 +34,9 @@ func TestEnvToBuildArgs(t *testing.T) {
 			os.Setenv(test.envKey, test.envVal)
 
 			// Read the env vars
-			b.CnbEnvVars = util.GetCNBEnvVar()
+			sources.Env = model.EnvArgs([]string{test.envKey + "=" + test.envVal, "PATH=/usr/bin"}, model.DefaultArgEnvPrefixes)
 
-			assert.Equal(t,"1","1")
+			assert.Equal(t, test.expectedBuildArgs, model.ArgStrings(sources.Env))
 		})
 	}
 }
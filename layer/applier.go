@@ -0,0 +1,359 @@
+package layer
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Options configures how the entries of a layer are applied onto the target dir
+type Options struct {
+	// Extract writes the entries under the target dir. When false, the entries are only read
+	Extract bool
+	// DryRun reports in the Changes of the Report what the layer would change, nothing is written. The changes stop
+	// at the first entry whose extraction would fail
+	DryRun bool
+	// PlanState is the target dir simulated by the layers already planned in dry-run mode. Nil plans the layer
+	// against the target dir as it is
+	PlanState *PlanState
+	// PreserveAttributes applies the owner, mode bits, xattrs and times of the entries
+	PreserveAttributes bool
+	// IDMappings converts the uid/gid of the entries when the attributes are preserved. Nil keeps them as they are
+	IDMappings *IDMappings
+	// OverwritePolicy is applied when an entry already exists under the target dir. Default is overwrite
+	OverwritePolicy OverwritePolicy
+	// BackupDir is the dir where the existing paths are copied when the policy is backup
+	BackupDir string
+	// Journal records the changes before doing them in order to roll them back. Nil disables the journal
+	Journal *Journal
+}
+
+// Applier applies the layers, one after the other, onto the target dir
+type Applier struct {
+	targetDir string
+	opts      Options
+}
+
+// NewApplier creates an Applier writing under targetDir
+func NewApplier(targetDir string, opts Options) *Applier {
+	if opts.OverwritePolicy == "" {
+		opts.OverwritePolicy = OverwritePolicyOverwrite
+	}
+	return &Applier{targetDir: filepath.Clean(targetDir), opts: opts}
+}
+
+// ApplyFile applies the layer stored in the file path. The file can be compressed with gzip
+func (a *Applier) ApplyFile(path string) (Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Report{}, &Error{Op: OpRead, Err: err}
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return Report{}, &Error{Op: OpRead, Err: err}
+		}
+		defer gzr.Close()
+		r = gzr
+	}
+	return a.Apply(r)
+}
+
+// Apply reads the uncompressed tar stream r of a layer and applies its entries onto the target dir.
+// The whiteouts delete the paths of the lower layers instead of being written. An error stops the extraction
+// and is returned as an *Error. The entries which cannot be created (e.g. a device without privileges) are
+// reported as Failed
+func (a *Applier) Apply(r io.Reader) (report Report, err error) {
+	s := layerState{
+		extracted:  map[string]bool{},
+		dirHeaders: map[string]*tar.Header{},
+		plan:       a.opts.PlanState,
+	}
+	if a.opts.DryRun && s.plan == nil {
+		s.plan = NewPlanState()
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, &Error{Op: OpRead, Err: err}
+		}
+		if err := a.applyEntry(tr, hdr, &s, &report); err != nil {
+			return report, err
+		}
+		if s.failed {
+			return report, nil
+		}
+	}
+
+	// The times of the dirs are set at the end as creating their content changes them
+	if a.opts.PreserveAttributes {
+		for target, hdr := range s.dirHeaders {
+			if err := applyTimes(hdr, target); err != nil {
+				report.Fail(target, "dir times", err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// layerState is what is tracked while applying the entries of one layer
+type layerState struct {
+	// Paths extracted from the layer which should not be deleted by an opaque whiteout marker
+	extracted map[string]bool
+	// Dirs whose times will be set when their content has been extracted
+	dirHeaders map[string]*tar.Header
+	// Target dir simulated in dry-run mode
+	plan *PlanState
+	// An entry planned in dry-run mode would fail the extraction, which stops there
+	failed bool
+}
+
+func (a *Applier) applyEntry(tr *tar.Reader, hdr *tar.Header, s *layerState, report *Report) error {
+	// the target location where the dir/file should be created. It must stay under the target dir
+	target, err := SecureJoin(a.targetDir, hdr.Name)
+	if err == nil && hdr.Typeflag == tar.TypeLink {
+		_, err = SecureJoin(a.targetDir, hdr.Linkname)
+	}
+	if err != nil {
+		return &Error{Op: OpResolve, Entry: hdr.Name, Err: err}
+	}
+	logrus.Debugf("File to be extracted: %s", target)
+	if isWhiteoutMeta(hdr.Name) {
+		logrus.Debugf("layer: whiteout metadata %s skipped", hdr.Name)
+		return nil
+	}
+
+	if a.opts.DryRun {
+		changes, err := s.plan.planEntry(hdr, tr, target, a.targetDir, s.extracted, a.opts.OverwritePolicy)
+		if err != nil {
+			return &Error{Op: OpPlan, Entry: hdr.Name, Path: target, Err: err}
+		}
+		for _, c := range changes {
+			s.failed = s.failed || c.Kind == ChangeFailed
+		}
+		if !isWhiteout(target) {
+			s.extracted[target] = true
+		}
+		report.Changes = append(report.Changes, changes...)
+		return nil
+	}
+	if !a.opts.Extract {
+		return nil
+	}
+
+	// Apply the OCI whiteout rules instead of writing the markers to the disk
+	if isOpaqueWhiteout(target) {
+		removed, err := removeOpaqueDirContent(target, s.extracted, a.remove)
+		if err != nil {
+			return &Error{Op: OpWhiteout, Entry: hdr.Name, Path: filepath.Dir(target), Err: err}
+		}
+		report.Removed = append(report.Removed, removed...)
+		return nil
+	}
+	if isWhiteout(target) {
+		removed, err := removeWhiteout(target, a.remove)
+		if err != nil {
+			return &Error{Op: OpWhiteout, Entry: hdr.Name, Path: whiteoutPath(target), Err: err}
+		}
+		if removed != "" {
+			report.Removed = append(report.Removed, removed)
+		}
+		return nil
+	}
+	s.extracted[target] = true
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		fi, err := os.Lstat(target)
+		if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			// A symbolic link to a dir is kept as its attributes cannot be changed without following it
+			logrus.Debugf("layer: %s exists and is a symbolic link", target)
+			return nil
+		}
+		if err != nil || !fi.IsDir() {
+			extract, err := a.resolveConflict(hdr, target, report)
+			if err != nil || !extract {
+				return err
+			}
+			if err := a.prepare(hdr, target); err != nil {
+				return err
+			}
+			if err := os.Mkdir(target, 0755); err != nil {
+				return &Error{Op: OpMkdir, Entry: hdr.Name, Path: target, Err: err}
+			}
+		} else if a.opts.PreserveAttributes {
+			// The attributes of the existing dir are going to be changed
+			if err := a.recordChanged(target); err != nil {
+				return &Error{Op: OpJournal, Entry: hdr.Name, Path: target, Err: err}
+			}
+		}
+		a.setAttributes(hdr, target, report)
+		s.dirHeaders[target] = hdr
+
+	case tar.TypeReg:
+		extract, err := a.resolveConflict(hdr, target, report)
+		if err != nil || !extract {
+			return err
+		}
+		if err := a.prepare(hdr, target); err != nil {
+			return err
+		}
+		outFile, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(hdr.Mode))
+		if err != nil {
+			return &Error{Op: OpCreate, Entry: hdr.Name, Path: target, Err: err}
+		}
+		if _, err := io.Copy(outFile, tr); err != nil {
+			outFile.Close()
+			return &Error{Op: OpCopy, Entry: hdr.Name, Path: target, Err: err}
+		}
+		// manually close here after each file operation; defering would cause each file close
+		// to wait until all operations have completed.
+		if err := outFile.Close(); err != nil {
+			return &Error{Op: OpCopy, Entry: hdr.Name, Path: target, Err: err}
+		}
+		logrus.Debugf("File extracted to %s", target)
+		a.setAttributes(hdr, target, report)
+
+	case tar.TypeSymlink, tar.TypeLink, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		extract, err := a.resolveConflict(hdr, target, report)
+		if err != nil || !extract {
+			return err
+		}
+		if err := a.prepare(hdr, target); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			err = createSymlink(hdr.Linkname, target)
+		case tar.TypeLink:
+			err = createHardlink(a.targetDir, hdr.Linkname, target)
+		default:
+			err = createSpecialFile(hdr, target)
+		}
+		if err != nil {
+			logrus.Warnf("layer: %s %s cannot be created: %s", typeName(hdr.Typeflag), target, err.Error())
+			report.Fail(target, typeName(hdr.Typeflag), err)
+			return nil
+		}
+		logrus.Debugf("%s extracted to %s", typeName(hdr.Typeflag), target)
+		// A hard link shares the attributes of the file it points to
+		if hdr.Typeflag != tar.TypeLink {
+			a.setAttributes(hdr, target, report)
+		}
+
+	default:
+		logrus.Debugf("layer: unknown type: %c in %s", hdr.Typeflag, hdr.Name)
+	}
+	return nil
+}
+
+// prepare creates the missing parent dirs of the entry, as a layer can omit them, including the target dir.
+// Then it records in the journal that target is going to be created
+func (a *Applier) prepare(hdr *tar.Header, target string) error {
+	var missing []string
+	for dir := filepath.Dir(target); len(dir) >= len(a.targetDir) && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return &Error{Op: OpMkdir, Entry: hdr.Name, Path: dir, Err: err}
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := a.recordCreated(missing[i]); err != nil {
+			return &Error{Op: OpJournal, Entry: hdr.Name, Path: missing[i], Err: err}
+		}
+		if err := os.Mkdir(missing[i], 0755); err != nil {
+			return &Error{Op: OpMkdir, Entry: hdr.Name, Path: missing[i], Err: err}
+		}
+	}
+
+	if err := a.recordCreated(target); err != nil {
+		return &Error{Op: OpJournal, Entry: hdr.Name, Path: target, Err: err}
+	}
+	return nil
+}
+
+// resolveConflict applies the OverwritePolicy when the target of the entry already exists. It returns false when
+// the entry should not be extracted and an error wrapping ErrConflict when the policy is fail
+func (a *Applier) resolveConflict(hdr *tar.Header, target string, report *Report) (bool, error) {
+	if _, err := os.Lstat(target); err != nil {
+		return true, nil
+	}
+	// The layer contains the hard link after the file it points to
+	if hdr.Typeflag == tar.TypeLink && filepath.Join(a.targetDir, hdr.Linkname) == target {
+		return false, nil
+	}
+
+	conflict := Conflict{Path: target, Type: typeName(hdr.Typeflag), Policy: a.opts.OverwritePolicy}
+	logrus.Debugf("layer: %s exists, policy: %s", target, a.opts.OverwritePolicy)
+	switch a.opts.OverwritePolicy {
+	case OverwritePolicySkip:
+		report.Conflicts = append(report.Conflicts, conflict)
+		return false, nil
+	case OverwritePolicyFail:
+		return false, &Error{Op: OpConflict, Entry: hdr.Name, Path: target, Err: ErrConflict}
+	case OverwritePolicyBackup:
+		backup, err := copyToBackup(a.opts.BackupDir, a.targetDir, target)
+		if err != nil {
+			return false, &Error{Op: OpBackup, Entry: hdr.Name, Path: target, Err: err}
+		}
+		conflict.Backup = backup
+	}
+	if err := a.remove(target); err != nil {
+		return false, &Error{Op: OpRemove, Entry: hdr.Name, Path: target, Err: err}
+	}
+	report.Conflicts = append(report.Conflicts, conflict)
+	return true, nil
+}
+
+// setAttributes applies the owner, mode bits, xattrs and times of the tar entry on target when PreserveAttributes
+// is enabled. A failure is reported but does not stop the extraction
+func (a *Applier) setAttributes(hdr *tar.Header, target string, report *Report) {
+	if !a.opts.PreserveAttributes {
+		return
+	}
+	if err := applyAttributes(hdr, target, a.opts.IDMappings); err != nil {
+		logrus.Warnf("layer: attributes of %s cannot be applied: %s", target, err.Error())
+		report.Fail(target, typeName(hdr.Typeflag)+" attributes", err)
+	}
+}
+
+// remove deletes the path. When the extraction is journaled, the path is moved to the backup dir of the journal
+// in order to restore it during a rollback
+func (a *Applier) remove(path string) error {
+	if a.opts.Journal != nil {
+		return a.opts.Journal.Remove(path)
+	}
+	return os.RemoveAll(path)
+}
+
+// recordCreated adds the path, which is going to be created, to the journal
+func (a *Applier) recordCreated(path string) error {
+	if a.opts.Journal != nil {
+		return a.opts.Journal.Created(path)
+	}
+	return nil
+}
+
+// recordChanged adds the current attributes of the existing path, which are going to be changed, to the journal
+func (a *Applier) recordChanged(path string) error {
+	if a.opts.Journal != nil {
+		return a.opts.Journal.Changed(path)
+	}
+	return nil
+}
@@ -0,0 +1,647 @@
+package layer
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/redhat-buildpacks/poc/layer/layertest"
+)
+
+// maliciousLayers is a corpus of layers trying to create or delete files outside of the target dir
+var maliciousLayers = []struct {
+	name    string
+	entries []layertest.Entry
+}{
+	{
+		name:    "parent dir traversal",
+		entries: []layertest.Entry{{Name: "../evil.txt", Typeflag: tar.TypeReg, Body: "evil"}},
+	},
+	{
+		name:    "absolute path traversal",
+		entries: []layertest.Entry{{Name: "/../../evil.txt", Typeflag: tar.TypeReg, Body: "evil"}},
+	},
+	{
+		name:    "nested dir traversal",
+		entries: []layertest.Entry{{Name: "usr/", Typeflag: tar.TypeDir}, {Name: "usr/../../evil.txt", Typeflag: tar.TypeReg, Body: "evil"}},
+	},
+	{
+		name: "write through a symlink to the parent dir",
+		entries: []layertest.Entry{
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "../"},
+			{Name: "escape/evil.txt", Typeflag: tar.TypeReg, Body: "evil"},
+		},
+	},
+	{
+		name: "write through a chain of symlinks",
+		entries: []layertest.Entry{
+			{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "b"},
+			{Name: "b", Typeflag: tar.TypeSymlink, Linkname: "usr/../.."},
+			{Name: "a/evil.txt", Typeflag: tar.TypeReg, Body: "evil"},
+		},
+	},
+	{
+		name: "overwrite through a symlink to the parent dir",
+		entries: []layertest.Entry{
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+			{Name: "escape/secret.txt", Typeflag: tar.TypeReg, Body: "evil"},
+		},
+	},
+	{
+		name:    "hardlink to a file outside the root dir",
+		entries: []layertest.Entry{{Name: "secret.txt", Typeflag: tar.TypeLink, Linkname: "../outside/secret.txt"}},
+	},
+	{
+		name:    "whiteout outside the root dir",
+		entries: []layertest.Entry{{Name: "../outside/.wh.secret.txt", Typeflag: tar.TypeReg}},
+	},
+	{
+		name: "opaque whiteout through a symlink",
+		entries: []layertest.Entry{
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+			{Name: "escape/.wh..wh..opq", Typeflag: tar.TypeReg},
+		},
+	},
+}
+
+func TestApplyEntryTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []layertest.Entry
+		check   func(t *testing.T, root string)
+	}{
+		{
+			name:    "dir",
+			entries: []layertest.Entry{{Name: "usr/", Typeflag: tar.TypeDir}, {Name: "usr/lib/", Typeflag: tar.TypeDir}},
+			check: func(t *testing.T, root string) {
+				if fi, err := os.Lstat(filepath.Join(root, "usr", "lib")); err != nil || !fi.IsDir() {
+					t.Errorf("usr/lib is not a dir: %v", err)
+				}
+			},
+		},
+		{
+			name:    "file",
+			entries: []layertest.Entry{{Name: "hello.txt", Typeflag: tar.TypeReg, Body: "hello"}},
+			check: func(t *testing.T, root string) {
+				if content, _ := os.ReadFile(filepath.Join(root, "hello.txt")); string(content) != "hello" {
+					t.Errorf("unexpected content %q", content)
+				}
+			},
+		},
+		{
+			name:    "symlink",
+			entries: []layertest.Entry{{Name: "lib", Typeflag: tar.TypeSymlink, Linkname: "/usr/lib"}},
+			check: func(t *testing.T, root string) {
+				if link, err := os.Readlink(filepath.Join(root, "lib")); err != nil || link != "/usr/lib" {
+					t.Errorf("unexpected link %q: %v", link, err)
+				}
+			},
+		},
+		{
+			name: "hardlink",
+			entries: []layertest.Entry{
+				{Name: "bin/", Typeflag: tar.TypeDir},
+				{Name: "bin/sh", Typeflag: tar.TypeReg, Body: "sh"},
+				{Name: "bin/bash", Typeflag: tar.TypeLink, Linkname: "bin/sh"},
+			},
+			check: func(t *testing.T, root string) {
+				sh, err1 := os.Stat(filepath.Join(root, "bin", "sh"))
+				bash, err2 := os.Stat(filepath.Join(root, "bin", "bash"))
+				if err1 != nil || err2 != nil || !os.SameFile(sh, bash) {
+					t.Errorf("bin/bash is not a hard link to bin/sh: %v, %v", err1, err2)
+				}
+			},
+		},
+		{
+			name:    "fifo",
+			entries: []layertest.Entry{{Name: "run/", Typeflag: tar.TypeDir}, {Name: "run/pipe", Typeflag: tar.TypeFifo}},
+			check: func(t *testing.T, root string) {
+				if fi, err := os.Lstat(filepath.Join(root, "run", "pipe")); err != nil || fi.Mode()&os.ModeNamedPipe == 0 {
+					t.Errorf("run/pipe is not a fifo: %v", err)
+				}
+			},
+		},
+		{
+			name:    "missing parent dirs of a file",
+			entries: []layertest.Entry{{Name: "usr/local/bin/tool", Typeflag: tar.TypeReg, Body: "tool"}},
+			check: func(t *testing.T, root string) {
+				if content, _ := os.ReadFile(filepath.Join(root, "usr", "local", "bin", "tool")); string(content) != "tool" {
+					t.Errorf("unexpected content %q", content)
+				}
+			},
+		},
+		{
+			name:    "missing parent dirs of a dir",
+			entries: []layertest.Entry{{Name: "var/lib/apt/", Typeflag: tar.TypeDir}},
+			check: func(t *testing.T, root string) {
+				if fi, err := os.Lstat(filepath.Join(root, "var", "lib", "apt")); err != nil || !fi.IsDir() {
+					t.Errorf("var/lib/apt is not a dir: %v", err)
+				}
+			},
+		},
+		{
+			name: "existing dir kept",
+			entries: []layertest.Entry{
+				{Name: "etc/", Typeflag: tar.TypeDir},
+				{Name: "etc/hosts", Typeflag: tar.TypeReg, Body: "hosts"},
+				{Name: "etc/", Typeflag: tar.TypeDir},
+			},
+			check: func(t *testing.T, root string) {
+				if _, err := os.Lstat(filepath.Join(root, "etc", "hosts")); err != nil {
+					t.Errorf("etc/hosts has been removed: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			report, err := NewApplier(root, Options{Extract: true}).Apply(layertest.NewLayer(t, test.entries))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Failed) > 0 {
+				t.Fatalf("unexpected failed entries: %v", report.Failed)
+			}
+			test.check(t, root)
+		})
+	}
+}
+
+func TestApplyWhiteouts(t *testing.T) {
+	tests := []struct {
+		name            string
+		entries         []layertest.Entry
+		expectedRemoved []string
+		expectedExist   []string
+	}{
+		{
+			name:            "whiteout of a file",
+			entries:         []layertest.Entry{{Name: "etc/.wh.passwd", Typeflag: tar.TypeReg}},
+			expectedRemoved: []string{"etc/passwd"},
+			expectedExist:   []string{"etc/group", "var/lib/apt/lists/partial"},
+		},
+		{
+			name:            "whiteout of a dir",
+			entries:         []layertest.Entry{{Name: "var/lib/.wh.apt", Typeflag: tar.TypeReg}},
+			expectedRemoved: []string{"var/lib/apt"},
+			expectedExist:   []string{"etc/passwd", "var/lib"},
+		},
+		{
+			name:          "whiteout of a missing path",
+			entries:       []layertest.Entry{{Name: "etc/.wh.shadow", Typeflag: tar.TypeReg}},
+			expectedExist: []string{"etc/passwd", "etc/group"},
+		},
+		{
+			name: "opaque whiteout",
+			entries: []layertest.Entry{
+				{Name: "etc/", Typeflag: tar.TypeDir},
+				{Name: "etc/hosts", Typeflag: tar.TypeReg, Body: "hosts"},
+				{Name: "etc/.wh..wh..opq", Typeflag: tar.TypeReg},
+			},
+			expectedRemoved: []string{"etc/group", "etc/passwd"},
+			expectedExist:   []string{"etc/hosts", "var/lib/apt/lists/partial"},
+		},
+		{
+			name: "aufs metadata",
+			entries: []layertest.Entry{
+				{Name: ".wh..wh.plnk/", Typeflag: tar.TypeDir},
+				{Name: ".wh..wh.plnk/1234.5678", Typeflag: tar.TypeReg, Body: "link"},
+				{Name: "etc/.wh..wh.aufs", Typeflag: tar.TypeReg},
+			},
+			expectedExist: []string{"etc/passwd", "etc/group", "var/lib/apt/lists/partial"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, p := range []string{"etc/passwd", "etc/group", "var/lib/apt/lists/partial"} {
+				if err := os.MkdirAll(filepath.Join(root, filepath.Dir(p)), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(root, p), []byte(p), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			report, err := NewApplier(root, Options{Extract: true}).Apply(layertest.NewLayer(t, test.entries))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Removed) != len(test.expectedRemoved) {
+				t.Fatalf("expected %v to be removed, got %v", test.expectedRemoved, report.Removed)
+			}
+			for i, p := range test.expectedRemoved {
+				if report.Removed[i] != filepath.Join(root, p) {
+					t.Errorf("expected %s to be removed, got %s", p, report.Removed[i])
+				}
+				if _, err := os.Lstat(filepath.Join(root, p)); !os.IsNotExist(err) {
+					t.Errorf("%s still exists: %v", p, err)
+				}
+			}
+			for _, p := range test.expectedExist {
+				if _, err := os.Lstat(filepath.Join(root, p)); err != nil {
+					t.Errorf("%s has been removed: %v", p, err)
+				}
+			}
+			for _, e := range test.entries {
+				if _, err := os.Lstat(filepath.Join(root, e.Name)); (isWhiteout(e.Name) || isWhiteoutMeta(e.Name)) && err == nil {
+					t.Errorf("the whiteout %s has been written", e.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRejectsMaliciousLayers(t *testing.T) {
+	for _, test := range maliciousLayers {
+		t.Run(test.name, func(t *testing.T) {
+			base := t.TempDir()
+			root := filepath.Join(base, "root")
+			outside := filepath.Join(base, "outside")
+			for _, dir := range []string{root, outside} {
+				if err := os.Mkdir(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			secret := filepath.Join(outside, "secret.txt")
+			if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := NewApplier(root, Options{Extract: true}).Apply(layertest.NewLayer(t, test.entries))
+			if !errors.Is(err, ErrPathEscapesRoot) {
+				t.Fatalf("expected the layer to be rejected, got: %v", err)
+			}
+			var layerErr *Error
+			if !errors.As(err, &layerErr) || layerErr.Op != OpResolve {
+				t.Fatalf("expected a %s error, got: %#v", OpResolve, err)
+			}
+
+			if content, err := os.ReadFile(secret); err != nil || string(content) != "secret" {
+				t.Fatalf("file outside of the root dir has been changed: %q, %v", content, err)
+			}
+			for _, p := range []string{filepath.Join(base, "evil.txt"), filepath.Join(filepath.Dir(base), "evil.txt")} {
+				if _, err := os.Lstat(p); err == nil {
+					t.Fatalf("file created outside of the root dir: %s", p)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyResolvesAbsoluteSymlinksUnderRoot(t *testing.T) {
+	root := t.TempDir()
+	_, err := NewApplier(root, Options{Extract: true}).Apply(layertest.NewLayer(t, []layertest.Entry{
+		{Name: "usr/", Typeflag: tar.TypeDir},
+		{Name: "usr/lib/", Typeflag: tar.TypeDir},
+		{Name: "lib", Typeflag: tar.TypeSymlink, Linkname: "/usr/lib"},
+		{Name: "lib/libfoo.so", Typeflag: tar.TypeReg, Body: "foo"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(root, "usr", "lib", "libfoo.so")); err != nil || string(content) != "foo" {
+		t.Fatalf("file not extracted under the root dir: %q, %v", content, err)
+	}
+}
+
+func TestApplyOverwritePolicy(t *testing.T) {
+	tests := []struct {
+		policy          OverwritePolicy
+		expectedContent string
+		expectedBackup  bool
+		expectedErr     error
+	}{
+		{policy: OverwritePolicyOverwrite, expectedContent: "new"},
+		{policy: OverwritePolicySkip, expectedContent: "old"},
+		{policy: OverwritePolicyFail, expectedContent: "old", expectedErr: ErrConflict},
+		{policy: OverwritePolicyBackup, expectedContent: "new", expectedBackup: true},
+	}
+	entries := []layertest.Entry{
+		{Name: "etc/", Typeflag: tar.TypeDir},
+		{Name: "etc/ca.crt", Typeflag: tar.TypeReg, Body: "new"},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			base := t.TempDir()
+			root := filepath.Join(base, "root")
+			if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(root, "etc", "ca.crt"), []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			a := NewApplier(root, Options{Extract: true, OverwritePolicy: test.policy, BackupDir: filepath.Join(base, "backup")})
+			report, err := a.Apply(layertest.NewLayer(t, entries))
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if content, _ := os.ReadFile(filepath.Join(root, "etc", "ca.crt")); string(content) != test.expectedContent {
+				t.Fatalf("expected content %q, got %q", test.expectedContent, content)
+			}
+			backup, _ := os.ReadFile(filepath.Join(base, "backup", "etc", "ca.crt"))
+			if test.expectedBackup != (string(backup) == "old") {
+				t.Fatalf("unexpected backup content %q", backup)
+			}
+			if test.expectedErr == nil && len(report.Conflicts) != 1 {
+				t.Fatalf("expected 1 conflict, got %v", report.Conflicts)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		layer         func(t *testing.T) io.Reader
+		expectedOp    Op
+		expectedEntry string
+		expectedErr   error
+	}{
+		{
+			name: "truncated layer",
+			layer: func(t *testing.T) io.Reader {
+				data, _ := io.ReadAll(layertest.NewLayer(t, []layertest.Entry{{Name: "hello.txt", Typeflag: tar.TypeReg, Body: "hello world"}}))
+				return bytes.NewReader(data[:520])
+			},
+			expectedOp:    OpCopy,
+			expectedEntry: "hello.txt",
+			expectedErr:   io.ErrUnexpectedEOF,
+		},
+		{
+			name: "invalid header",
+			layer: func(t *testing.T) io.Reader {
+				return bytes.NewReader(bytes.Repeat([]byte("x"), 1024))
+			},
+			expectedOp: OpRead,
+		},
+		{
+			name: "parent is a file",
+			layer: func(t *testing.T) io.Reader {
+				return layertest.NewLayer(t, []layertest.Entry{
+					{Name: "etc", Typeflag: tar.TypeReg, Body: "file"},
+					{Name: "etc/ssl/cert.pem", Typeflag: tar.TypeReg, Body: "cert"},
+				})
+			},
+			expectedOp:    OpResolve,
+			expectedEntry: "etc/ssl/cert.pem",
+			expectedErr:   syscall.ENOTDIR,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewApplier(t.TempDir(), Options{Extract: true}).Apply(test.layer(t))
+			var layerErr *Error
+			if !errors.As(err, &layerErr) {
+				t.Fatalf("expected an *Error, got: %v", err)
+			}
+			if layerErr.Op != test.expectedOp || layerErr.Entry != test.expectedEntry {
+				t.Errorf("expected %s of %q, got %s of %q", test.expectedOp, test.expectedEntry, layerErr.Op, layerErr.Entry)
+			}
+			if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected %v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"modified": "old", "unchanged": "same", "deleted": "gone"} {
+		if err := os.WriteFile(filepath.Join(root, "etc", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(filepath.Join(root, "etc", name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := NewApplier(root, Options{Extract: true, DryRun: true}).Apply(layertest.NewLayer(t, []layertest.Entry{
+		{Name: "etc/modified", Typeflag: tar.TypeReg, Body: "new"},
+		{Name: "etc/unchanged", Typeflag: tar.TypeReg, Body: "same"},
+		{Name: "etc/added", Typeflag: tar.TypeReg, Body: "added"},
+		{Name: "etc/.wh.deleted", Typeflag: tar.TypeReg},
+		{Name: "etc/.wh..wh.aufs", Typeflag: tar.TypeReg},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]ChangeKind{
+		filepath.Join(root, "etc", "modified"):  ChangeModified,
+		filepath.Join(root, "etc", "unchanged"): ChangeUnchanged,
+		filepath.Join(root, "etc", "added"):     ChangeAdded,
+		filepath.Join(root, "etc", "deleted"):   ChangeDeleted,
+	}
+	if len(report.Changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %v", len(expected), report.Changes)
+	}
+	for _, c := range report.Changes {
+		if expected[c.Path] != c.Kind {
+			t.Errorf("%s: expected %s, got %s %v", c.Path, expected[c.Path], c.Kind, c.Details)
+		}
+	}
+
+	// Nothing should have been written under the root dir
+	if _, err := os.Lstat(filepath.Join(root, "etc", "added")); err == nil {
+		t.Error("etc/added has been extracted")
+	}
+	if _, err := os.Lstat(filepath.Join(root, "etc", "deleted")); err != nil {
+		t.Error("etc/deleted has been removed")
+	}
+	if content, _ := os.ReadFile(filepath.Join(root, "etc", "modified")); string(content) != "old" {
+		t.Error("etc/modified has been overwritten")
+	}
+}
+
+func TestApplyDryRunLayers(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "etc", "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"etc/existing", "etc/conf.d/default"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(filepath.Join(root, name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The layers are planned, one after the other, against what the previous ones would have left
+	layers := [][]layertest.Entry{
+		{
+			{Name: "etc/added", Typeflag: tar.TypeReg, Body: "v1"},
+			{Name: "etc/removed", Typeflag: tar.TypeReg, Body: "v1"},
+			{Name: "etc/same", Typeflag: tar.TypeReg, Body: "v1"},
+			{Name: "etc/existing", Typeflag: tar.TypeReg, Body: "new"},
+			{Name: "etc/conf.d/custom", Typeflag: tar.TypeReg, Body: "v1"},
+		},
+		{
+			{Name: "etc/added", Typeflag: tar.TypeReg, Body: "v2"},
+			{Name: "etc/.wh.removed", Typeflag: tar.TypeReg},
+			{Name: "etc/same", Typeflag: tar.TypeReg, Body: "v1"},
+			{Name: "etc/.wh.existing", Typeflag: tar.TypeReg},
+			{Name: "etc/conf.d/.wh..wh..opq", Typeflag: tar.TypeReg},
+			{Name: "etc/conf.d/kept", Typeflag: tar.TypeReg, Body: "v2"},
+		},
+		{
+			{Name: "etc/existing", Typeflag: tar.TypeReg, Body: "new"},
+			{Name: "etc/.wh.removed", Typeflag: tar.TypeReg},
+			{Name: "etc/conf.d/default", Typeflag: tar.TypeReg, Body: "old"},
+		},
+	}
+	expected := [][]Change{
+		{
+			{Path: "etc/added", Kind: ChangeAdded},
+			{Path: "etc/removed", Kind: ChangeAdded},
+			{Path: "etc/same", Kind: ChangeAdded},
+			{Path: "etc/existing", Kind: ChangeModified, Details: []string{"content"}},
+			{Path: "etc/conf.d/custom", Kind: ChangeAdded},
+		},
+		{
+			{Path: "etc/added", Kind: ChangeModified, Details: []string{"content"}},
+			{Path: "etc/removed", Kind: ChangeDeleted},
+			{Path: "etc/same", Kind: ChangeUnchanged},
+			{Path: "etc/existing", Kind: ChangeDeleted},
+			{Path: "etc/conf.d/default", Kind: ChangeDeleted},
+			{Path: "etc/conf.d/custom", Kind: ChangeDeleted},
+			{Path: "etc/conf.d/kept", Kind: ChangeAdded},
+		},
+		{
+			{Path: "etc/existing", Kind: ChangeAdded},
+			{Path: "etc/conf.d/default", Kind: ChangeAdded},
+		},
+	}
+
+	state := NewPlanState()
+	for i, entries := range layers {
+		report, err := NewApplier(root, Options{DryRun: true, PlanState: state}).Apply(layertest.NewLayer(t, entries))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Changes) != len(expected[i]) {
+			t.Fatalf("layer %d: expected %d changes, got %v", i, len(expected[i]), report.Changes)
+		}
+		for j, c := range report.Changes {
+			e := expected[i][j]
+			if c.Path != filepath.Join(root, e.Path) || c.Kind != e.Kind || !reflect.DeepEqual(c.Details, e.Details) {
+				t.Errorf("layer %d: expected %s %s %v, got %s %s %v", i, e.Kind, e.Path, e.Details, c.Kind, c.Path, c.Details)
+			}
+		}
+	}
+
+	// Nothing should have been written under the root dir
+	if _, err := os.Lstat(filepath.Join(root, "etc", "added")); err == nil {
+		t.Error("etc/added has been extracted")
+	}
+	if content, _ := os.ReadFile(filepath.Join(root, "etc", "existing")); string(content) != "old" {
+		t.Error("etc/existing has been overwritten")
+	}
+}
+
+func TestApplyDryRunPolicy(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "existing"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries := []layertest.Entry{
+		{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "etc/existing", Typeflag: tar.TypeReg, Body: "new"},
+		{Name: "etc/added", Typeflag: tar.TypeReg, Body: "added"},
+	}
+
+	// The existing dir is merged, the existing file is handled by the policy
+	tests := []struct {
+		policy   OverwritePolicy
+		expected []Change
+	}{
+		{policy: OverwritePolicyOverwrite, expected: []Change{
+			{Path: "etc", Kind: ChangeUnchanged},
+			{Path: "etc/existing", Kind: ChangeModified, Policy: OverwritePolicyOverwrite},
+			{Path: "etc/added", Kind: ChangeAdded},
+		}},
+		{policy: OverwritePolicySkip, expected: []Change{
+			{Path: "etc", Kind: ChangeUnchanged},
+			{Path: "etc/existing", Kind: ChangeSkipped, Policy: OverwritePolicySkip},
+			{Path: "etc/added", Kind: ChangeAdded},
+		}},
+		{policy: OverwritePolicyFail, expected: []Change{
+			{Path: "etc", Kind: ChangeUnchanged},
+			{Path: "etc/existing", Kind: ChangeFailed, Policy: OverwritePolicyFail},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			report, err := NewApplier(root, Options{DryRun: true, OverwritePolicy: test.policy}).Apply(layertest.NewLayer(t, entries))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Changes) != len(test.expected) {
+				t.Fatalf("expected %d changes, got %v", len(test.expected), report.Changes)
+			}
+			for i, c := range report.Changes {
+				e := test.expected[i]
+				if c.Path != filepath.Join(root, e.Path) || c.Kind != e.Kind || c.Policy != e.Policy {
+					t.Errorf("expected %s %s %s, got %s %s %s", e.Kind, e.Path, e.Policy, c.Kind, c.Path, c.Policy)
+				}
+			}
+
+			plan := NewPlan(root)
+			plan.Add("Dockerfile", "sha256:layer", report.Changes)
+			if failed := plan.Failure != nil; failed != (test.policy == OverwritePolicyFail) {
+				t.Errorf("unexpected failure %+v", plan.Failure)
+			}
+		})
+	}
+}
+
+func TestApplyWithoutExtract(t *testing.T) {
+	root := t.TempDir()
+	_, err := NewApplier(root, Options{}).Apply(layertest.NewLayer(t, []layertest.Entry{{Name: "hello.txt", Typeflag: tar.TypeReg, Body: "hello"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "hello.txt")); !os.IsNotExist(err) {
+		t.Errorf("hello.txt has been extracted: %v", err)
+	}
+}
+
+func TestApplyFile(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		name := "tar"
+		if compressed {
+			name = "tar.gz"
+		}
+		t.Run(name, func(t *testing.T) {
+			base := t.TempDir()
+			root := filepath.Join(base, "root")
+			path := layertest.WriteLayer(t, base, compressed, []layertest.Entry{{Name: "hello.txt", Typeflag: tar.TypeReg, Body: "hello"}})
+
+			if _, err := NewApplier(root, Options{Extract: true}).ApplyFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if content, _ := os.ReadFile(filepath.Join(root, "hello.txt")); string(content) != "hello" {
+				t.Errorf("unexpected content %q", content)
+			}
+		})
+	}
+}
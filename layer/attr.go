@@ -0,0 +1,63 @@
+package layer
+
+import (
+	"archive/tar"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// paxXattrPrefix prefixes the PAX records containing the extended attributes of a tar entry
+const paxXattrPrefix = "SCHILY.xattr."
+
+// applyAttributes sets on target the owner, mode bits (setuid, setgid, sticky included) and extended attributes
+// (e.g. security.capability) of the tar entry. The owner is converted using the idMappings when not nil.
+// The times of a dir are not changed as they should be set when the content of the dir has been extracted
+func applyAttributes(hdr *tar.Header, target string, idMappings *IDMappings) error {
+	uid, gid := hdr.Uid, hdr.Gid
+	if idMappings != nil {
+		var err error
+		if uid, gid, err = idMappings.ToHost(uid, gid); err != nil {
+			return err
+		}
+	}
+
+	// The owner must be changed first as chown clears the setuid, setgid bits and the file capabilities
+	if err := os.Lchown(target, uid, gid); err != nil {
+		return err
+	}
+
+	if hdr.Typeflag != tar.TypeSymlink {
+		mode := hdr.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+	}
+
+	for key, value := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		if err := unix.Lsetxattr(target, strings.TrimPrefix(key, paxXattrPrefix), []byte(value), 0); err != nil {
+			return err
+		}
+	}
+
+	if hdr.Typeflag != tar.TypeDir {
+		return applyTimes(hdr, target)
+	}
+	return nil
+}
+
+// applyTimes sets the access and modification times of the tar entry on target without following the symlinks
+func applyTimes(hdr *tar.Header, target string) error {
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = hdr.ModTime
+	}
+	return unix.Lutimes(target, []unix.Timeval{
+		unix.NsecToTimeval(atime.UnixNano()),
+		unix.NsecToTimeval(hdr.ModTime.UnixNano()),
+	})
+}
@@ -0,0 +1,240 @@
+package layer
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/redhat-buildpacks/poc/layer/layertest"
+	"golang.org/x/sys/unix"
+)
+
+func TestApplyAttributes(t *testing.T) {
+	modTime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	newFile := func(t *testing.T, path string) {
+		if err := os.WriteFile(path, []byte("content"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newDir := func(t *testing.T, path string) {
+		if err := os.Mkdir(path, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newSymlink := func(t *testing.T, path string) {
+		if err := os.Symlink("target", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idMappings := &IDMappings{
+		UIDs: []IDMap{{ContainerID: 0, HostID: 1000, Size: 1}, {ContainerID: 1, HostID: 100000, Size: 65536}},
+		GIDs: []IDMap{{ContainerID: 0, HostID: 1000, Size: 1}, {ContainerID: 1, HostID: 100000, Size: 65536}},
+	}
+
+	tests := []struct {
+		name       string
+		create     func(t *testing.T, path string)
+		hdr        tar.Header
+		idMappings *IDMappings
+		root       bool // chown and the xattrs of the trusted namespace require the root user
+		mode       os.FileMode
+		uid, gid   int
+		xattrs     map[string]string
+		modTime    bool // The times of the entry are applied, the ones of a dir are set later
+		err        bool
+	}{
+		{
+			name:    "file mode",
+			create:  newFile,
+			hdr:     tar.Header{Typeflag: tar.TypeReg, Mode: 0640, ModTime: modTime},
+			mode:    0640,
+			uid:     -1,
+			modTime: true,
+		},
+		{
+			name:    "setuid and setgid bits",
+			create:  newFile,
+			hdr:     tar.Header{Typeflag: tar.TypeReg, Mode: 06755, ModTime: modTime},
+			mode:    0755 | os.ModeSetuid | os.ModeSetgid,
+			uid:     -1,
+			modTime: true,
+		},
+		{
+			name:   "sticky dir",
+			create: newDir,
+			hdr:    tar.Header{Typeflag: tar.TypeDir, Mode: 01777, ModTime: modTime},
+			mode:   os.ModeDir | 0777 | os.ModeSticky,
+			uid:    -1,
+		},
+		{
+			name:    "symlink",
+			create:  newSymlink,
+			hdr:     tar.Header{Typeflag: tar.TypeSymlink, Mode: 0600, ModTime: modTime},
+			mode:    os.ModeSymlink | 0777,
+			uid:     -1,
+			modTime: true,
+		},
+		{
+			name:    "owner",
+			create:  newFile,
+			hdr:     tar.Header{Typeflag: tar.TypeReg, Mode: 0644, Uid: 1001, Gid: 1002, ModTime: modTime},
+			root:    true,
+			mode:    0644,
+			uid:     1001,
+			gid:     1002,
+			modTime: true,
+		},
+		{
+			name:       "owner mapped to the host",
+			create:     newFile,
+			hdr:        tar.Header{Typeflag: tar.TypeReg, Mode: 0644, Uid: 0, Gid: 10, ModTime: modTime},
+			idMappings: idMappings,
+			root:       true,
+			mode:       0644,
+			uid:        1000,
+			gid:        100009,
+			modTime:    true,
+		},
+		{
+			name:       "owner not mapped",
+			create:     newFile,
+			hdr:        tar.Header{Typeflag: tar.TypeReg, Mode: 0644, Uid: 70000, ModTime: modTime},
+			idMappings: idMappings,
+			err:        true,
+		},
+		{
+			name:   "xattrs",
+			create: newFile,
+			hdr: tar.Header{Typeflag: tar.TypeReg, Mode: 0644, ModTime: modTime,
+				PAXRecords: map[string]string{paxXattrPrefix + "trusted.extender": "value", "comment": "not a xattr"}},
+			root:    true,
+			mode:    0644,
+			uid:     -1,
+			xattrs:  map[string]string{"trusted.extender": "value"},
+			modTime: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.root && os.Getuid() != 0 {
+				t.Skip("requires the root user")
+			}
+			target := filepath.Join(t.TempDir(), "target")
+			test.create(t, target)
+			hdr := test.hdr
+			if test.uid == -1 {
+				// Keep the owner of the test as chown requires the root user
+				hdr.Uid, hdr.Gid = os.Getuid(), os.Getgid()
+			}
+
+			err := applyAttributes(&hdr, target, test.idMappings)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				if errors.Is(err, unix.ENOTSUP) {
+					t.Skipf("not supported by the file system: %v", err)
+				}
+				t.Fatal(err)
+			}
+
+			fi, err := os.Lstat(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode() != test.mode {
+				t.Errorf("expected mode %s, got %s", test.mode, fi.Mode())
+			}
+			if st := fi.Sys().(*syscall.Stat_t); test.uid != -1 && (int(st.Uid) != test.uid || int(st.Gid) != test.gid) {
+				t.Errorf("expected owner %d:%d, got %d:%d", test.uid, test.gid, st.Uid, st.Gid)
+			}
+			if fi.ModTime().Equal(modTime) != test.modTime {
+				t.Errorf("unexpected modification time %s", fi.ModTime())
+			}
+			for name, value := range test.xattrs {
+				buf := make([]byte, 64)
+				n, err := unix.Lgetxattr(target, name, buf)
+				if err != nil || string(buf[:n]) != value {
+					t.Errorf("xattr %s: expected %q, got %q %v", name, value, buf[:n], err)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyTimes(t *testing.T) {
+	modTime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	accessTime := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		hdr        tar.Header
+		accessTime time.Time
+	}{
+		{name: "access time", hdr: tar.Header{ModTime: modTime, AccessTime: accessTime}, accessTime: accessTime},
+		{name: "no access time", hdr: tar.Header{ModTime: modTime}, accessTime: modTime},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "target")
+			if err := os.WriteFile(target, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyTimes(&test.hdr, target); err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Lstat(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			st := fi.Sys().(*syscall.Stat_t)
+			if atime := time.Unix(st.Atim.Unix()); !fi.ModTime().Equal(modTime) || !atime.Equal(test.accessTime) {
+				t.Errorf("expected times %s %s, got %s %s", test.accessTime, modTime, atime, fi.ModTime())
+			}
+		})
+	}
+}
+
+func TestApplyPreserveAttributes(t *testing.T) {
+	root := t.TempDir()
+	dirTime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	fileTime := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	_, err := NewApplier(root, Options{Extract: true, PreserveAttributes: true}).Apply(layertest.NewLayer(t, []layertest.Entry{
+		{Name: "opt/", Typeflag: tar.TypeDir, Mode: 0750, ModTime: dirTime},
+		{Name: "opt/tool", Typeflag: tar.TypeReg, Body: "tool", Mode: 04755, ModTime: fileTime},
+		{Name: "opt/conf", Typeflag: tar.TypeReg, Body: "conf", Mode: 0600, ModTime: fileTime},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The times of the dir are set once its content has been extracted
+	tests := []struct {
+		path    string
+		mode    os.FileMode
+		modTime time.Time
+	}{
+		{path: "opt", mode: os.ModeDir | 0750, modTime: dirTime},
+		{path: "opt/tool", mode: 0755 | os.ModeSetuid, modTime: fileTime},
+		{path: "opt/conf", mode: 0600, modTime: fileTime},
+	}
+	for _, test := range tests {
+		fi, err := os.Lstat(filepath.Join(root, test.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != test.mode {
+			t.Errorf("%s: expected mode %s, got %s", test.path, test.mode, fi.Mode())
+		}
+		if !fi.ModTime().Equal(test.modTime) {
+			t.Errorf("%s: expected modification time %s, got %s", test.path, test.modTime, fi.ModTime())
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package layer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// copyToBackup copies the path, located under rootDir, to the same relative path under backupDir and returns
+// the path of the backup. If a backup of the path already exists, it is kept as it contains the original content
+func copyToBackup(backupDir, rootDir, path string) (string, error) {
+	rel, err := filepath.Rel(rootDir, path)
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(backupDir, rel)
+
+	if _, err := os.Lstat(dst); err == nil {
+		return dst, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	return dst, copyPath(path, dst)
+}
+
+// movePath moves src to dst. When rename fails as dst is not on the same device, src is copied then removed
+func movePath(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyPath(src, dst); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyPath copies a file, a symbolic link, a dir or a special file (fifo, device) with its owner, mode bits,
+// extended attributes and times
+func copyPath(src, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		err = os.Symlink(link, dst)
+	case fi.IsDir():
+		err = copyDir(src, dst)
+	case fi.Mode().IsRegular():
+		err = copyFile(src, dst)
+	case fi.Mode()&(os.ModeNamedPipe|os.ModeDevice|os.ModeCharDevice) != 0:
+		err = copySpecialFile(dst, fi)
+	default:
+		return fmt.Errorf("%s cannot be copied to %s", src, dst)
+	}
+	if err != nil {
+		return err
+	}
+	// The attributes of a dir are copied once its content has been copied as it can be read only
+	return copyAttributes(src, dst, fi)
+}
+
+// copyDir copies the dir src and its content
+func copyDir(src, dst string) error {
+	if err := os.Mkdir(dst, 0700); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := copyPath(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies the content of the regular file src
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copySpecialFile creates dst with the type and the device number of the fifo or device described by fi
+func copySpecialFile(dst string, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("%s cannot be copied: no device number", fi.Name())
+	}
+	return unix.Mknod(dst, st.Mode&^07777|0600, int(st.Rdev))
+}
+
+// copyAttributes sets on dst the owner, mode bits (setuid, setgid, sticky included), extended attributes and times
+// of src. The owner and the extended attributes which cannot be set without privileges are logged and skipped
+func copyAttributes(src, dst string, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("%s: no owner", src)
+	}
+
+	// The owner must be changed first as chown clears the setuid, setgid bits and the file capabilities
+	if err := os.Lchown(dst, int(st.Uid), int(st.Gid)); err != nil {
+		if !os.IsPermission(err) {
+			return err
+		}
+		logrus.Warnf("layer: owner %d:%d of %s cannot be kept: %s", st.Uid, st.Gid, dst, err.Error())
+	}
+	if err := copyXattrs(src, dst); err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		if err := os.Chmod(dst, fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+	}
+	return unix.Lutimes(dst, []unix.Timeval{
+		unix.NsecToTimeval(time.Unix(st.Atim.Unix()).UnixNano()),
+		unix.NsecToTimeval(fi.ModTime().UnixNano()),
+	})
+}
+
+// copyXattrs copies the extended attributes of src to dst without following the symlinks
+func copyXattrs(src, dst string) error {
+	size, err := unix.Llistxattr(src, nil)
+	if err != nil || size == 0 {
+		// The file system of src may not support the extended attributes
+		return nil
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(src, buf); err != nil {
+		return err
+	}
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		value := make([]byte, 64*1024)
+		n, err := unix.Lgetxattr(src, name, value)
+		if err != nil {
+			return err
+		}
+		if err := unix.Lsetxattr(dst, name, value[:n], 0); err != nil {
+			if err != unix.EPERM && err != unix.ENOTSUP {
+				return err
+			}
+			logrus.Warnf("layer: extended attribute %s of %s cannot be kept: %s", name, dst, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package layer
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCopyPath(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "bin", "tool"), []byte("tool"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(src, "fifo"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin/tool", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for path, mode := range map[string]os.FileMode{"bin/tool": 0750 | os.ModeSetuid, "bin": 0555, "fifo": 0640} {
+		if err := os.Chmod(filepath.Join(src, path), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(src, path), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The copy of the read only dir must be writable by the test cleanup
+	defer os.Chmod(filepath.Join(src, "bin"), 0755)
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	if err := copyPath(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(dst, "bin"), 0755)
+
+	tests := []struct {
+		path string
+		mode os.FileMode
+	}{
+		{path: "bin", mode: os.ModeDir | 0555},
+		{path: "bin/tool", mode: 0750 | os.ModeSetuid},
+		{path: "fifo", mode: os.ModeNamedPipe | 0640},
+	}
+	for _, test := range tests {
+		fi, err := os.Lstat(filepath.Join(dst, test.path))
+		if err != nil {
+			t.Errorf("%s not copied: %v", test.path, err)
+			continue
+		}
+		if fi.Mode() != test.mode {
+			t.Errorf("%s: expected mode %s, got %s", test.path, test.mode, fi.Mode())
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s: expected modification time %s, got %s", test.path, mtime, fi.ModTime())
+		}
+		st := fi.Sys().(*syscall.Stat_t)
+		if int(st.Uid) != os.Getuid() || int(st.Gid) != os.Getgid() {
+			t.Errorf("%s: owner not kept, got %d:%d", test.path, st.Uid, st.Gid)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "bin/tool" {
+		t.Errorf("link not copied: %q %v", link, err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dst, "bin", "tool")); string(content) != "tool" {
+		t.Errorf("content of bin/tool not copied, got %q", content)
+	}
+}
@@ -0,0 +1,7 @@
+// Package layer applies the tar stream of an image layer onto a dir, independently of the engine (kaniko, buildah)
+// which built the image.
+//
+// The entries are confined to the dir, the OCI whiteouts are applied, the missing parent dirs are created and the
+// existing paths are handled according to an OverwritePolicy. The changes can be reported without writing anything
+// (dry run) or recorded in a Journal in order to roll them back.
+package layer
@@ -0,0 +1,59 @@
+package layer
+
+import (
+	"archive/tar"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// typeName returns a human readable name of the type of the tar entry
+func typeName(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeReg, tar.TypeRegA:
+		return "file"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeChar:
+		return "char device"
+	case tar.TypeBlock:
+		return "block device"
+	case tar.TypeFifo:
+		return "fifo"
+	default:
+		return string(typeflag)
+	}
+}
+
+// createSymlink creates at target a symbolic link pointing to linkname. The linkname is kept as it is
+// as it will be resolved against the root FS when used
+func createSymlink(linkname, target string) error {
+	return os.Symlink(linkname, target)
+}
+
+// createHardlink creates at target a hard link to the file linkname which is relative to the root of the layer
+func createHardlink(targetDir, linkname, target string) error {
+	source, err := SecureJoin(targetDir, linkname)
+	if err != nil {
+		return err
+	}
+	return os.Link(source, target)
+}
+
+// createSpecialFile creates at target the char device, block device or fifo described by the tar header
+func createSpecialFile(hdr *tar.Header, target string) error {
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= unix.S_IFCHR
+	case tar.TypeBlock:
+		mode |= unix.S_IFBLK
+	case tar.TypeFifo:
+		mode |= unix.S_IFIFO
+	}
+	return unix.Mknod(target, mode, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))))
+}
@@ -0,0 +1,54 @@
+package layer
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrPathEscapesRoot is returned when a tar entry or a symbolic link resolves to a path outside of the root dir
+	ErrPathEscapesRoot = errors.New("path escapes the root dir")
+	// ErrConflict is returned when an entry already exists under the target dir and the overwrite policy is fail
+	ErrConflict = errors.New("path already exists and the overwrite policy is fail")
+)
+
+// Op is the operation which failed while applying an entry of a layer
+type Op string
+
+const (
+	OpRead     Op = "read"
+	OpResolve  Op = "resolve"
+	OpPlan     Op = "plan"
+	OpWhiteout Op = "whiteout"
+	OpConflict Op = "conflict"
+	OpBackup   Op = "backup"
+	OpRemove   Op = "remove"
+	OpMkdir    Op = "mkdir"
+	OpCreate   Op = "create"
+	OpCopy     Op = "copy"
+	OpJournal  Op = "journal"
+)
+
+// Error is returned when a layer cannot be applied. The cause can be tested using errors.Is or errors.As
+// (e.g. ErrPathEscapesRoot, ErrConflict, *os.PathError)
+type Error struct {
+	Op    Op
+	Entry string // Name of the entry within the layer. Empty when the layer cannot be read
+	Path  string // Path of the entry under the target dir. Empty when it has not been resolved
+	Err   error
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Entry == "":
+		return fmt.Sprintf("layer %s failed: %v", e.Op, e.Err)
+	case e.Path == "":
+		return fmt.Sprintf("layer entry %s: %s failed: %v", e.Entry, e.Op, e.Err)
+	default:
+		return fmt.Sprintf("layer entry %s: %s of %s failed: %v", e.Entry, e.Op, e.Path, e.Err)
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,8 @@
+module github.com/redhat-buildpacks/poc/layer
+
+go 1.16
+
+require (
+	github.com/sirupsen/logrus v1.8.1
+	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e
+)
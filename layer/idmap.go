@@ -0,0 +1,127 @@
+package layer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SubUIDFile is the default file containing the subordinate user ids. See buildah/config/subid
+	SubUIDFile = "/etc/subuid"
+	// SubGIDFile is the default file containing the subordinate group ids. See buildah/config/subid
+	SubGIDFile = "/etc/subgid"
+)
+
+// IDMap maps a range of ids of the layer to a range of ids of the host. Same format as /proc/self/uid_map
+type IDMap struct {
+	ContainerID int
+	HostID      int
+	Size        int
+}
+
+// IDMappings contains the uid and gid maps to be used when the layers are extracted by a rootless user
+type IDMappings struct {
+	UIDs []IDMap
+	GIDs []IDMap
+}
+
+// LoadIDMappings creates the mappings of the current user as a rootless container engine does: the root
+// id of the layer is mapped to the id of the user and the other ids to the range of the subid files
+func LoadIDMappings(subUIDFile, subGIDFile string) (*IDMappings, error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	uidRanges, err := readSubIDFile(subUIDFile, u.Username, u.Uid)
+	if err != nil {
+		return nil, err
+	}
+	gidRanges, err := readSubIDFile(subGIDFile, u.Username, u.Uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IDMappings{
+		UIDs: append([]IDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}, toIDMaps(uidRanges)...),
+		GIDs: append([]IDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}, toIDMaps(gidRanges)...),
+	}, nil
+}
+
+// ToHost converts the uid and gid of a layer entry to the ids to be used on the host
+func (m *IDMappings) ToHost(uid, gid int) (int, int, error) {
+	hostUID, err := toHost(m.UIDs, uid)
+	if err != nil {
+		return -1, -1, fmt.Errorf("uid %s", err)
+	}
+	hostGID, err := toHost(m.GIDs, gid)
+	if err != nil {
+		return -1, -1, fmt.Errorf("gid %s", err)
+	}
+	return hostUID, hostGID, nil
+}
+
+func toHost(maps []IDMap, id int) (int, error) {
+	for _, m := range maps {
+		if id >= m.ContainerID && id < m.ContainerID+m.Size {
+			return m.HostID + id - m.ContainerID, nil
+		}
+	}
+	return -1, fmt.Errorf("%d is not mapped", id)
+}
+
+// toIDMaps maps the ids 1..n of the layer to the subordinate id ranges
+func toIDMaps(ranges []IDMap) []IDMap {
+	var maps []IDMap
+	containerID := 1
+	for _, r := range ranges {
+		maps = append(maps, IDMap{ContainerID: containerID, HostID: r.HostID, Size: r.Size})
+		containerID += r.Size
+	}
+	return maps
+}
+
+// readSubIDFile returns the ranges declared for the user within a file using the format `name_or_id:start:count`
+func readSubIDFile(path, userName, userID string) ([]IDMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ranges []IDMap
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid line %q in %s", line, path)
+		}
+		if fields[0] != userName && fields[0] != userID {
+			continue
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid start id in %s: %s", path, err)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid count in %s: %s", path, err)
+		}
+		ranges = append(ranges, IDMap{HostID: start, Size: count})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no subordinate ids declared for the user %s in %s", userName, path)
+	}
+	return ranges, nil
+}
@@ -0,0 +1,161 @@
+package layer
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSubIDFile creates a subid file with the content and returns its path
+func writeSubIDFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "subid")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadSubIDFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []IDMap
+		err      bool
+	}{
+		{
+			name:     "user name",
+			content:  "other:100000:65536\nbuilder:200000:65536\n",
+			expected: []IDMap{{HostID: 200000, Size: 65536}},
+		},
+		{
+			name:     "user id",
+			content:  "1000:300000:1000\n",
+			expected: []IDMap{{HostID: 300000, Size: 1000}},
+		},
+		{
+			name:     "several ranges, comments and blank lines",
+			content:  "# subordinate ids\n\nbuilder:100000:1000\n  1000:200000:500  \n",
+			expected: []IDMap{{HostID: 100000, Size: 1000}, {HostID: 200000, Size: 500}},
+		},
+		{name: "no range of the user", content: "other:100000:65536\n", err: true},
+		{name: "invalid line", content: "builder:100000\n", err: true},
+		{name: "invalid start id", content: "builder:first:65536\n", err: true},
+		{name: "invalid count", content: "builder:100000:all\n", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ranges, err := readSubIDFile(writeSubIDFile(t, test.content), "builder", "1000")
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", ranges)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ranges, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, ranges)
+			}
+		})
+	}
+
+	if _, err := readSubIDFile(filepath.Join(t.TempDir(), "missing"), "builder", "1000"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestToIDMaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranges   []IDMap
+		expected []IDMap
+	}{
+		{name: "no range"},
+		{
+			name:     "one range",
+			ranges:   []IDMap{{HostID: 100000, Size: 65536}},
+			expected: []IDMap{{ContainerID: 1, HostID: 100000, Size: 65536}},
+		},
+		{
+			name:     "consecutive container ids",
+			ranges:   []IDMap{{HostID: 100000, Size: 1000}, {HostID: 300000, Size: 500}},
+			expected: []IDMap{{ContainerID: 1, HostID: 100000, Size: 1000}, {ContainerID: 1001, HostID: 300000, Size: 500}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if maps := toIDMaps(test.ranges); !reflect.DeepEqual(maps, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, maps)
+			}
+		})
+	}
+}
+
+func TestToHost(t *testing.T) {
+	ranges, err := readSubIDFile(writeSubIDFile(t, "builder:100000:1000\nbuilder:300000:500\n"), "builder", "1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &IDMappings{
+		UIDs: append([]IDMap{{ContainerID: 0, HostID: 1000, Size: 1}}, toIDMaps(ranges)...),
+		GIDs: append([]IDMap{{ContainerID: 0, HostID: 2000, Size: 1}}, toIDMaps(ranges)...),
+	}
+
+	tests := []struct {
+		name             string
+		uid, gid         int
+		hostUID, hostGID int
+		err              bool
+	}{
+		{name: "root", uid: 0, gid: 0, hostUID: 1000, hostGID: 2000},
+		{name: "first range", uid: 1, gid: 1000, hostUID: 100000, hostGID: 100999},
+		{name: "second range", uid: 1001, gid: 1500, hostUID: 300000, hostGID: 300499},
+		{name: "uid not mapped", uid: 1501, gid: 0, err: true},
+		{name: "gid not mapped", uid: 0, gid: -1, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uid, gid, err := m.ToHost(test.uid, test.gid)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %d:%d", uid, gid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uid != test.hostUID || gid != test.hostGID {
+				t.Errorf("expected %d:%d, got %d:%d", test.hostUID, test.hostGID, uid, gid)
+			}
+		})
+	}
+}
+
+func TestLoadIDMappings(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subUIDFile := writeSubIDFile(t, u.Username+":100000:65536\n")
+	subGIDFile := writeSubIDFile(t, u.Uid+":200000:1000\n")
+
+	m, err := LoadIDMappings(subUIDFile, subGIDFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &IDMappings{
+		UIDs: []IDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}, {ContainerID: 1, HostID: 100000, Size: 65536}},
+		GIDs: []IDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}, {ContainerID: 1, HostID: 200000, Size: 1000}},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %+v, got %+v", expected, m)
+	}
+
+	if _, err := LoadIDMappings(subUIDFile, writeSubIDFile(t, "other:200000:1000\n")); err == nil {
+		t.Error("expected an error as no subordinate gid is declared for the user")
+	}
+}
@@ -0,0 +1,371 @@
+package layer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// JournalBegin is the first entry of the journal and records its backup dir
+	JournalBegin = "begin"
+	// JournalCreated is recorded before a path is created
+	JournalCreated = "created"
+	// JournalRemoved is recorded before a path is moved to the backup dir of the journal
+	JournalRemoved = "removed"
+	// JournalAttributes is recorded, with the current ones, before the attributes of an existing path are changed
+	JournalAttributes = "attributes"
+	// JournalCommit is recorded when all the layers of an extraction have been applied
+	JournalCommit = "commit"
+)
+
+// JournalRuns is the number of committed runs whose changes are kept, with their backups, to be rolled back. When a
+// run is committed, the changes of the older runs are pruned: their backups are deleted and they cannot be rolled back
+const JournalRuns = 5
+
+// JournalEntry is a line of the journal file
+type JournalEntry struct {
+	Action     string          `json:"action"`
+	Path       string          `json:"path,omitempty"`
+	Backup     string          `json:"backup,omitempty"`
+	Attributes *FileAttributes `json:"attributes,omitempty"`
+}
+
+// FileAttributes are the attributes of an existing path restored by a rollback
+type FileAttributes struct {
+	Mode  os.FileMode `json:"mode"`
+	Uid   int         `json:"uid"`
+	Gid   int         `json:"gid"`
+	Atime time.Time   `json:"atime"`
+	Mtime time.Time   `json:"mtime"`
+}
+
+// Journal records, before doing them, the changes of the extractions on the root FS dir: the paths created, the
+// existing paths removed or replaced which are moved to the backup dir and the attributes of the existing paths
+// changed. The entries not followed by a commit are rolled back when an extraction fails or has been interrupted and
+// the entries of the last JournalRuns runs can be rolled back on demand
+type Journal struct {
+	path      string
+	backupDir string
+	file      *os.File
+	entries   []JournalEntry
+	runs      []int // Number of entries committed at the end of each run kept
+	committed int   // Number of entries committed
+	next      int   // Sequence number of the next backup
+}
+
+// NewJournal opens the journal file in order to record the changes of a new run. The entries committed by the
+// previous runs are kept, as well as their backups, in order to roll back the last runs. When there is no journal
+// file, it is created with its backup dir, which must not exist or be empty. The changes not committed must have been
+// rolled back before
+func NewJournal(path, backupDir string) (*Journal, error) {
+	if _, err := os.Lstat(path); err == nil {
+		j, err := LoadJournal(path)
+		if err != nil {
+			return nil, err
+		}
+		if j.Pending() {
+			j.Close()
+			return nil, fmt.Errorf("journal %s contains changes not committed", path)
+		}
+		// The file is rewritten as its last line can be truncated
+		if err := j.rewrite(); err != nil {
+			j.Close()
+			return nil, err
+		}
+		return j, nil
+	}
+
+	// The content of a backup dir which has not been created by the journal is never deleted
+	if names, err := readDirNames(backupDir); err != nil {
+		return nil, err
+	} else if len(names) > 0 {
+		return nil, fmt.Errorf("backup dir %s of the new journal %s is not empty", backupDir, path)
+	}
+	if err := os.MkdirAll(backupDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: path, backupDir: backupDir, file: f}
+	if err := j.write(JournalEntry{Action: JournalBegin, Backup: backupDir}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// LoadJournal reads an existing journal file. The backup dir is the one recorded with the entries
+func LoadJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{path: path, file: f}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// The last line can be truncated if the application has been killed while writing it
+			break
+		}
+		switch e.Action {
+		case JournalBegin:
+			j.backupDir = e.Backup
+		case JournalCommit:
+			j.commit()
+		default:
+			j.entries = append(j.entries, e)
+			j.reserve(e.Backup)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// Pending returns true when some entries have not been committed
+func (j *Journal) Pending() bool {
+	return len(j.entries) > j.committed
+}
+
+// Created records that the path is going to be created
+func (j *Journal) Created(path string) error {
+	return j.write(JournalEntry{Action: JournalCreated, Path: path})
+}
+
+// Remove moves the path to the backup dir of the journal instead of deleting it
+func (j *Journal) Remove(path string) error {
+	e := JournalEntry{Action: JournalRemoved, Path: path, Backup: filepath.Join(j.backupDir, fmt.Sprintf("%08d", j.next))}
+	if err := j.write(e); err != nil {
+		return err
+	}
+	j.reserve(e.Backup)
+	return movePath(path, e.Backup)
+}
+
+// Changed records the attributes of the existing path before they are changed
+func (j *Journal) Changed(path string) error {
+	attrs, err := readAttributes(path)
+	if err != nil {
+		return err
+	}
+	return j.write(JournalEntry{Action: JournalAttributes, Path: path, Attributes: attrs})
+}
+
+// Commit records that the changes done since the last commit are complete, then prunes the changes of the runs older
+// than the last JournalRuns ones
+func (j *Journal) Commit() error {
+	if err := j.write(JournalEntry{Action: JournalCommit}); err != nil {
+		return err
+	}
+	j.commit()
+	if len(j.runs) <= JournalRuns {
+		return j.file.Sync()
+	}
+	pruned := j.runs[len(j.runs)-JournalRuns-1]
+	for _, e := range j.entries[:pruned] {
+		if e.Action == JournalRemoved {
+			if err := os.RemoveAll(e.Backup); err != nil {
+				return err
+			}
+		}
+	}
+	j.entries = j.entries[pruned:]
+	j.committed -= pruned
+	runs := j.runs[len(j.runs)-JournalRuns:]
+	j.runs = nil
+	for _, n := range runs {
+		j.runs = append(j.runs, n-pruned)
+	}
+	return j.rewrite()
+}
+
+// RollbackPending undoes the changes which have not been committed
+func (j *Journal) RollbackPending() error {
+	if err := j.undo(j.committed); err != nil {
+		return err
+	}
+	return j.rewrite()
+}
+
+// Rollback undoes all the changes recorded and removes the journal. The backup dir, emptied by the rollback, is
+// removed unless it contains paths which have not been moved by the journal
+func (j *Journal) Rollback() error {
+	if err := j.undo(0); err != nil {
+		return err
+	}
+	j.file.Close()
+	if err := os.Remove(j.path); err != nil {
+		return err
+	}
+	if err := os.Remove(j.backupDir); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("backup dir of the journal rolled back cannot be removed: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// undo reverts, from the last one, the entries recorded after the index from
+func (j *Journal) undo(from int) error {
+	for i := len(j.entries) - 1; i >= from; i-- {
+		e := j.entries[i]
+		switch e.Action {
+		case JournalCreated:
+			if err := os.RemoveAll(e.Path); err != nil {
+				return err
+			}
+		case JournalRemoved:
+			// The path has not been moved if the application stopped after recording the entry
+			if _, err := os.Lstat(e.Backup); err != nil {
+				continue
+			}
+			if err := os.RemoveAll(e.Path); err != nil {
+				return err
+			}
+			if err := movePath(e.Backup, e.Path); err != nil {
+				return err
+			}
+		case JournalAttributes:
+			if err := restoreAttributes(e.Path, e.Attributes); err != nil {
+				return err
+			}
+		}
+	}
+	j.entries = j.entries[:from]
+	return nil
+}
+
+// commit marks the entries recorded as committed, closing a run when some changes have been recorded since the last
+// commit
+func (j *Journal) commit() {
+	if len(j.entries) > j.committed {
+		j.runs = append(j.runs, len(j.entries))
+	}
+	j.committed = len(j.entries)
+}
+
+// reserve makes sure that the next backup does not reuse the name of the backup of an entry
+func (j *Journal) reserve(backup string) {
+	if backup == "" {
+		return
+	}
+	if n, err := strconv.Atoi(filepath.Base(backup)); err == nil && n >= j.next {
+		j.next = n + 1
+	}
+}
+
+// readDirNames returns the names of the content of a dir, which can be missing
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+// readAttributes returns the mode bits, owner and times of the path, without following the symlinks
+func readAttributes(path string) (*FileAttributes, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, fmt.Errorf("%s: no owner", path)
+	}
+	return &FileAttributes{
+		Mode:  fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky),
+		Uid:   int(st.Uid),
+		Gid:   int(st.Gid),
+		Atime: time.Unix(st.Atim.Unix()),
+		Mtime: fi.ModTime(),
+	}, nil
+}
+
+// restoreAttributes sets the attributes recorded on the path. A path which does not exist anymore is ignored
+func restoreAttributes(path string, attrs *FileAttributes) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The owner is restored first as chown clears the setuid and setgid bits
+	if st, ok := fi.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != attrs.Uid || int(st.Gid) != attrs.Gid {
+		if err := os.Lchown(path, attrs.Uid, attrs.Gid); err != nil {
+			return err
+		}
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		if err := os.Chmod(path, attrs.Mode); err != nil {
+			return err
+		}
+	}
+	return unix.Lutimes(path, []unix.Timeval{
+		unix.NsecToTimeval(attrs.Atime.UnixNano()),
+		unix.NsecToTimeval(attrs.Mtime.UnixNano()),
+	})
+}
+
+// rewrite replaces the content of the journal file with the entries committed, followed by the commit of each run
+func (j *Journal) rewrite() error {
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	entries, runs := j.entries, j.runs
+	j.entries = nil
+	if err := j.write(JournalEntry{Action: JournalBegin, Backup: j.backupDir}); err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if err := j.write(e); err != nil {
+			return err
+		}
+		if len(runs) > 0 && runs[0] == i+1 {
+			if err := j.write(JournalEntry{Action: JournalCommit}); err != nil {
+				return err
+			}
+			runs = runs[1:]
+		}
+	}
+	return j.file.Sync()
+}
+
+func (j *Journal) write(e JournalEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if e.Action == JournalCreated || e.Action == JournalRemoved || e.Action == JournalAttributes {
+		j.entries = append(j.entries, e)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package layer
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redhat-buildpacks/poc/layer/layertest"
+)
+
+func TestJournalRollback(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "ca.crt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "removed"), []byte("removed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries := []layertest.Entry{
+		{Name: "etc/", Typeflag: tar.TypeDir},
+		{Name: "etc/ca.crt", Typeflag: tar.TypeReg, Body: "new"},
+		{Name: "etc/.wh.removed", Typeflag: tar.TypeReg},
+		{Name: "usr/local/bin/tool", Typeflag: tar.TypeReg, Body: "tool"},
+	}
+	failing := append(append([]layertest.Entry{}, entries...), layertest.Entry{Name: "../evil.txt", Typeflag: tar.TypeReg, Body: "evil"})
+	journalFile := filepath.Join(base, "journal.json")
+	backupDir := filepath.Join(base, "journal")
+
+	apply := func(t *testing.T, entries []layertest.Entry) (*Journal, error) {
+		journal, err := NewJournal(journalFile, backupDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewApplier(root, Options{Extract: true, Journal: journal}).Apply(layertest.NewLayer(t, entries))
+		return journal, err
+	}
+	load := func(t *testing.T) *Journal {
+		journal, err := LoadJournal(journalFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return journal
+	}
+	assertRolledBack := func(t *testing.T) {
+		if content, _ := os.ReadFile(filepath.Join(root, "etc", "ca.crt")); string(content) != "old" {
+			t.Errorf("etc/ca.crt not restored, got %q", content)
+		}
+		if content, _ := os.ReadFile(filepath.Join(root, "etc", "removed")); string(content) != "removed" {
+			t.Errorf("etc/removed not restored, got %q", content)
+		}
+		if _, err := os.Lstat(filepath.Join(root, "usr")); !os.IsNotExist(err) {
+			t.Errorf("usr has not been removed: %v", err)
+		}
+	}
+
+	t.Run("failed extraction", func(t *testing.T) {
+		journal, err := apply(t, failing)
+		if err == nil {
+			t.Fatal("expected the extraction to fail")
+		}
+		if err := journal.RollbackPending(); err != nil {
+			t.Fatal(err)
+		}
+		journal.Close()
+		assertRolledBack(t)
+	})
+
+	t.Run("interrupted extraction", func(t *testing.T) {
+		journal, err := apply(t, entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		journal.Close()
+
+		journal = load(t)
+		if !journal.Pending() {
+			t.Fatal("expected the changes not committed to be pending")
+		}
+		if err := journal.RollbackPending(); err != nil {
+			t.Fatal(err)
+		}
+		journal.Close()
+		assertRolledBack(t)
+	})
+
+	t.Run("rollback of a committed extraction", func(t *testing.T) {
+		journal, err := apply(t, entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := journal.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		journal.Close()
+		if content, _ := os.ReadFile(filepath.Join(root, "etc", "ca.crt")); string(content) != "new" {
+			t.Fatalf("etc/ca.crt not extracted, got %q", content)
+		}
+
+		journal = load(t)
+		if journal.Pending() {
+			t.Fatal("expected no pending change")
+		}
+		if err := journal.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		assertRolledBack(t)
+		if _, err := os.Lstat(journalFile); !os.IsNotExist(err) {
+			t.Errorf("journal not removed: %v", err)
+		}
+	})
+	t.Run("rollback of several runs", func(t *testing.T) {
+		for _, entries := range [][]layertest.Entry{
+			{{Name: "etc/ca.crt", Typeflag: tar.TypeReg, Body: "first"}},
+			{{Name: "etc/ca.crt", Typeflag: tar.TypeReg, Body: "new"}, {Name: "etc/.wh.removed", Typeflag: tar.TypeReg}},
+			{{Name: "usr/local/bin/tool", Typeflag: tar.TypeReg, Body: "tool"}},
+		} {
+			journal, err := apply(t, entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := journal.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			journal.Close()
+		}
+
+		// The changes of all the runs are rolled back, not only the ones of the last run
+		if err := load(t).Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		assertRolledBack(t)
+	})
+
+	t.Run("new run with pending changes", func(t *testing.T) {
+		journal, err := apply(t, entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		journal.Close()
+		if _, err := NewJournal(journalFile, backupDir); err == nil {
+			t.Error("expected an error as the changes of the previous run are not committed")
+		}
+		journal = load(t)
+		if err := journal.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		assertRolledBack(t)
+	})
+}
+
+func TestJournalRollbackAttributes(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	dir := filepath.Join(root, "etc")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(dir, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err := NewJournal(filepath.Join(base, "journal.json"), filepath.Join(base, "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewApplier(root, Options{Extract: true, PreserveAttributes: true, Journal: journal}).Apply(layertest.NewLayer(t, []layertest.Entry{
+		{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0700},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(dir); err != nil || fi.Mode().Perm() != 0700 {
+		t.Fatalf("mode of etc not changed: %v %v", fi, err)
+	}
+
+	if err := journal.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Errorf("mode of etc not restored, got %s", fi.Mode())
+	}
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("modification time of etc not restored, got %s", fi.ModTime())
+	}
+}
+
+func TestJournalRetention(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	journalFile := filepath.Join(base, "journal.json")
+	backupDir := filepath.Join(base, "journal")
+
+	// Each run replaces the file written by the previous one, whose backup is kept while the run can be rolled back
+	for i := 0; i <= JournalRuns+1; i++ {
+		journal, err := NewJournal(journalFile, backupDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewApplier(root, Options{Extract: true, Journal: journal}).Apply(layertest.NewLayer(t, []layertest.Entry{
+			{Name: "version", Typeflag: tar.TypeReg, Body: strconv.Itoa(i)},
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := journal.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		journal.Close()
+	}
+	if names, err := readDirNames(backupDir); err != nil || len(names) != JournalRuns {
+		t.Errorf("expected the backups of the last %d runs, got %v %v", JournalRuns, names, err)
+	}
+
+	// The runs which have been pruned are not rolled back
+	journal, err := LoadJournal(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(root, "version")); string(content) != "1" {
+		t.Errorf("expected the file of the last run pruned, got %q", content)
+	}
+	if _, err := os.Lstat(backupDir); !os.IsNotExist(err) {
+		t.Errorf("backup dir not removed: %v", err)
+	}
+}
+
+func TestJournalBackupDirNotEmpty(t *testing.T) {
+	base := t.TempDir()
+	backupDir := filepath.Join(base, "backup")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(backupDir, "data"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJournal(filepath.Join(base, "journal.json"), backupDir); err == nil {
+		t.Error("expected an error as the backup dir is not empty")
+	}
+	if _, err := os.Lstat(filepath.Join(backupDir, "data")); err != nil {
+		t.Errorf("the content of the backup dir has been deleted: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package layer
+
+import "fmt"
+
+// NewLayers returns, in order, the indexes of the layers of an image which do not belong to its base image, i.e. the
+// layers following the ones of the base image. The layers are compared using their diffID (digest of the uncompressed
+// content): the diffIDs of the base image must be the first diffIDs of the image, in the same order
+func NewLayers(diffIDs []string, baseDiffIDs []string) ([]int, error) {
+	if len(baseDiffIDs) > len(diffIDs) {
+		return nil, fmt.Errorf("the image has %d layers, less than the %d layers of its base image", len(diffIDs), len(baseDiffIDs))
+	}
+	for i, d := range baseDiffIDs {
+		if diffIDs[i] != d {
+			return nil, fmt.Errorf("layer %d of the image is %s instead of the layer %s of its base image", i, diffIDs[i], d)
+		}
+	}
+
+	var indexes []int
+	for i := len(baseDiffIDs); i < len(diffIDs); i++ {
+		indexes = append(indexes, i)
+	}
+	return indexes, nil
+}
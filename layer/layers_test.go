@@ -0,0 +1,42 @@
+package layer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewLayers(t *testing.T) {
+	tests := []struct {
+		name        string
+		diffIDs     []string
+		baseDiffIDs []string
+		expected    []int
+		invalid     bool
+	}{
+		{name: "no base image", diffIDs: []string{"a", "b"}, expected: []int{0, 1}},
+		{name: "one base layer", diffIDs: []string{"a", "b"}, baseDiffIDs: []string{"a"}, expected: []int{1}},
+		{name: "several base layers", diffIDs: []string{"a", "b", "c", "d"}, baseDiffIDs: []string{"a", "b"}, expected: []int{2, 3}},
+		{name: "no new layer", diffIDs: []string{"a", "b"}, baseDiffIDs: []string{"a", "b"}},
+		{name: "base layer created again", diffIDs: []string{"e", "a", "e"}, baseDiffIDs: []string{"e", "a"}, expected: []int{2}},
+		{name: "duplicate base layer", diffIDs: []string{"e", "e", "a"}, baseDiffIDs: []string{"e", "a"}, invalid: true},
+		{name: "reordered base layers", diffIDs: []string{"b", "a", "c"}, baseDiffIDs: []string{"a", "b"}, invalid: true},
+		{name: "fewer layers than the base image", diffIDs: []string{"a"}, baseDiffIDs: []string{"a", "b"}, invalid: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewLayers(test.diffIDs, test.baseDiffIDs)
+			if test.invalid {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Package layertest builds the layers used by the tests of the layer applier and of the applications extracting them
+package layertest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// Entry is an entry of a layer. The owner of the entry is the user running the test
+type Entry struct {
+	Name     string
+	Typeflag byte
+	Linkname string
+	Body     string
+	Mode     int64 // Default is 0644, 0755 for a dir
+	ModTime  time.Time
+}
+
+// NewLayer returns the uncompressed content of a layer containing the entries
+func NewLayer(t testing.TB, entries []Entry) io.Reader {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.Name, Typeflag: e.Typeflag, Linkname: e.Linkname, Mode: e.Mode, Size: int64(len(e.Body)),
+			Uid: os.Getuid(), Gid: os.Getgid(), ModTime: e.ModTime}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+			if e.Typeflag == tar.TypeDir {
+				hdr.Mode = 0755
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.Body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// WriteLayer creates under dir a layer file containing the entries, compressed with gzip or not, and returns its path
+func WriteLayer(t testing.TB, dir string, compressed bool, entries []Entry) string {
+	f, err := os.CreateTemp(dir, "layer-*.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var w io.WriteCloser = f
+	if compressed {
+		w = gzip.NewWriter(f)
+	}
+	if _, err := io.Copy(w, NewLayer(t, entries)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
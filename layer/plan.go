@@ -0,0 +1,433 @@
+package layer
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+// ChangeKind classifies how a path of the target dir is changed by a layer
+type ChangeKind string
+
+const (
+	ChangeAdded     ChangeKind = "added"
+	ChangeModified  ChangeKind = "modified"
+	ChangeDeleted   ChangeKind = "deleted"
+	ChangeUnchanged ChangeKind = "unchanged"
+	ChangeSkipped   ChangeKind = "skipped" // The path exists and the overwrite policy is skip
+	ChangeFailed    ChangeKind = "failed"  // The path exists and the overwrite policy is fail
+)
+
+// Change is a path of the target dir which would be changed when the layer is extracted
+type Change struct {
+	Path    string          `json:"path"`
+	Type    string          `json:"type"`
+	Kind    ChangeKind      `json:"change"`
+	Details []string        `json:"details,omitempty"` // What is modified: type, content, link, mode, owner
+	Policy  OverwritePolicy `json:"policy,omitempty"`  // Overwrite policy applied as the path already exists
+}
+
+// Plan lists, layer by layer, the changes that the extraction of the layers would do on the target dir
+type Plan struct {
+	TargetDir string             `json:"targetDir"`
+	Summary   map[ChangeKind]int `json:"summary"`
+	Layers    []LayerPlan        `json:"layers"`
+	Failure   *Change            `json:"failure,omitempty"` // Entry on which the extraction would fail and stop
+}
+
+// LayerPlan lists the changes of a layer in the order of its entries
+type LayerPlan struct {
+	Dockerfile string   `json:"dockerfile,omitempty"` // Dockerfile which has produced the layer
+	Layer      string   `json:"layer,omitempty"`      // Digest of the layer
+	Changes    []Change `json:"changes"`
+}
+
+// NewPlan creates an empty Plan of the target dir
+func NewPlan(targetDir string) *Plan {
+	return &Plan{
+		TargetDir: targetDir,
+		Summary:   map[ChangeKind]int{ChangeAdded: 0, ChangeModified: 0, ChangeDeleted: 0, ChangeUnchanged: 0, ChangeSkipped: 0, ChangeFailed: 0},
+	}
+}
+
+// Add appends the changes of a layer of the Dockerfile to the plan, counts them per kind and records the first failure
+func (p *Plan) Add(dockerfile, layer string, changes []Change) {
+	p.Layers = append(p.Layers, LayerPlan{Dockerfile: dockerfile, Layer: layer, Changes: changes})
+	for i, c := range changes {
+		p.Summary[c.Kind]++
+		if c.Kind == ChangeFailed && p.Failure == nil {
+			p.Failure = &changes[i]
+		}
+	}
+}
+
+// PlanState is the target dir as simulated by the layers already planned in dry-run mode. When the Appliers of
+// the layers share it, a layer is planned against what the previous layers would have left, not against the
+// unmodified target dir
+type PlanState struct {
+	entries map[string]plannedEntry // Paths written by the layers planned
+	deleted map[string]bool         // Paths deleted by the layers planned. Their content is deleted too
+}
+
+// plannedEntry is what a layer planned would have written to a path
+type plannedEntry struct {
+	typeflag byte
+	linkname string
+	mode     os.FileMode
+	uid, gid int
+	size     int64
+	digest   []byte // sha256 of the content of a regular file
+}
+
+// NewPlanState creates the state of a target dir on which no layer has been planned
+func NewPlanState() *PlanState {
+	return &PlanState{entries: map[string]plannedEntry{}, deleted: map[string]bool{}}
+}
+
+// planEntry compares the tar entry with the target path, as left by the layers already planned, and returns the
+// change(s) that its extraction would do. As during the extraction, the overwrite policy is applied when the path
+// already exists: a skipped entry leaves the path as it is and a failed one stops the extraction. The content of a
+// regular file is read from r. Nothing is written under the target dir
+func (s *PlanState) planEntry(hdr *tar.Header, r io.Reader, target string, targetDir string, extracted map[string]bool, policy OverwritePolicy) ([]Change, error) {
+	if isOpaqueWhiteout(target) {
+		changes, err := s.opaqueDirContent(filepath.Dir(target), extracted)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range changes {
+			s.remove(c.Path, extracted)
+		}
+		return changes, nil
+	}
+	if isWhiteout(target) {
+		hidden := whiteoutPath(target)
+		kind, ok := s.typeOf(hidden)
+		if !ok {
+			return nil, nil
+		}
+		s.remove(hidden, nil)
+		return []Change{{Path: hidden, Type: kind, Kind: ChangeDeleted}}, nil
+	}
+
+	entry, err := newPlannedEntry(hdr, r)
+	if err != nil {
+		return nil, err
+	}
+	change := Change{Path: target, Type: typeName(hdr.Typeflag)}
+	// A dir entry is merged with an existing dir and kept when the existing path is a symlink
+	merged := false
+	if previous, ok := s.entries[target]; ok {
+		change.Details = previous.diff(entry)
+		change.Kind = changeKind(change.Details)
+		merged = previous.typeflag == tar.TypeDir || previous.typeflag == tar.TypeSymlink
+	} else if fi, err := os.Lstat(target); s.isDeleted(target) || os.IsNotExist(err) {
+		change.Kind = ChangeAdded
+	} else if err != nil {
+		return nil, err
+	} else {
+		if change.Details, err = entry.diffFile(target, targetDir, fi); err != nil {
+			return nil, err
+		}
+		change.Kind = changeKind(change.Details)
+		merged = fi.IsDir() || fi.Mode()&os.ModeSymlink != 0
+	}
+
+	// The layer contains the hard link after the file it points to
+	self := hdr.Typeflag == tar.TypeLink && filepath.Join(targetDir, hdr.Linkname) == target
+	if change.Kind != ChangeAdded && !(hdr.Typeflag == tar.TypeDir && merged) && !self {
+		change.Policy = policy
+		switch policy {
+		case OverwritePolicySkip:
+			change.Kind = ChangeSkipped
+			return []Change{change}, nil
+		case OverwritePolicyFail:
+			change.Kind = ChangeFailed
+			return []Change{change}, nil
+		}
+	}
+	s.record(target, entry)
+	return []Change{change}, nil
+}
+
+// typeOf returns the type name of the path, if it exists in the simulated target dir
+func (s *PlanState) typeOf(path string) (string, bool) {
+	if e, ok := s.entries[path]; ok {
+		return typeName(e.typeflag), true
+	}
+	if s.isDeleted(path) {
+		return "", false
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return "", false
+	}
+	return fileTypeName(fi), true
+}
+
+// isDeleted returns true when the path, or one of its parent dirs, has been deleted by a layer planned
+func (s *PlanState) isDeleted(path string) bool {
+	for p := path; ; p = filepath.Dir(p) {
+		if s.deleted[p] {
+			return true
+		}
+		if p == filepath.Dir(p) {
+			return false
+		}
+	}
+}
+
+// record stores the entry written to the path. An entry which is not a dir replaces the content of a dir
+func (s *PlanState) record(path string, e plannedEntry) {
+	if e.typeflag != tar.TypeDir {
+		s.remove(path, nil)
+	}
+	s.entries[path] = e
+}
+
+// remove deletes the path and its content from the simulated target dir, except the paths to keep
+func (s *PlanState) remove(path string, keep map[string]bool) {
+	s.deleted[path] = true
+	for p := range s.entries {
+		if (p == path || strings.HasPrefix(p, path+string(filepath.Separator))) && !keep[p] {
+			delete(s.entries, p)
+		}
+	}
+}
+
+// opaqueDirContent returns the changes deleting the content of the dir, on the disk and written by the layers
+// planned, except the paths which have been extracted from the layer currently planned. A dir is returned without
+// its content
+func (s *PlanState) opaqueDirContent(dir string, extracted map[string]bool) ([]Change, error) {
+	var changes []Change
+	hidden := map[string]bool{}
+	add := func(path, kind string) {
+		changes = append(changes, Change{Path: path, Type: kind, Kind: ChangeDeleted})
+		hidden[path] = true
+	}
+
+	if _, err := os.Lstat(dir); err == nil && !s.isDeleted(dir) {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == dir || extracted[path] {
+				return nil
+			}
+			if _, ok := s.entries[path]; !ok && s.isDeleted(path) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			kind, _ := s.typeOf(path)
+			add(path, kind)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var paths []string
+	for p := range s.entries {
+		if strings.HasPrefix(p, dir+string(filepath.Separator)) && !extracted[p] && !hidden[p] {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if !parentIn(hidden, p, dir) {
+			add(p, typeName(s.entries[p].typeflag))
+		}
+	}
+	return changes, nil
+}
+
+// parentIn returns true when a parent dir of path, below the dir, belongs to the paths
+func parentIn(paths map[string]bool, path, dir string) bool {
+	for p := filepath.Dir(path); len(p) > len(dir); p = filepath.Dir(p) {
+		if paths[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// newPlannedEntry reads the tar entry. The content of a regular file is hashed
+func newPlannedEntry(hdr *tar.Header, r io.Reader) (plannedEntry, error) {
+	modeBits := os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	e := plannedEntry{
+		typeflag: hdr.Typeflag,
+		linkname: hdr.Linkname,
+		mode:     hdr.FileInfo().Mode() & modeBits,
+		uid:      hdr.Uid,
+		gid:      hdr.Gid,
+	}
+	if hdr.Typeflag == tar.TypeRegA {
+		e.typeflag = tar.TypeReg
+	}
+	if e.typeflag == tar.TypeReg {
+		h := sha256.New()
+		size, err := io.Copy(h, r)
+		if err != nil {
+			return e, err
+		}
+		e.size, e.digest = size, h.Sum(nil)
+	}
+	return e, nil
+}
+
+// diff returns what the entry e changes on the path written by the entry previous: type, content, link, mode, owner
+func (previous plannedEntry) diff(e plannedEntry) []string {
+	if typeName(previous.typeflag) != typeName(e.typeflag) && e.typeflag != tar.TypeLink {
+		return []string{"type"}
+	}
+	var details []string
+	switch e.typeflag {
+	case tar.TypeReg:
+		if previous.size != e.size || !bytes.Equal(previous.digest, e.digest) {
+			details = append(details, "content")
+		}
+	case tar.TypeSymlink, tar.TypeLink:
+		if previous.typeflag != e.typeflag || previous.linkname != e.linkname {
+			details = append(details, "link")
+		}
+	}
+	if e.typeflag != tar.TypeSymlink && e.typeflag != tar.TypeLink && previous.mode != e.mode {
+		details = append(details, "mode")
+	}
+	if e.typeflag != tar.TypeLink && (previous.uid != e.uid || previous.gid != e.gid) {
+		details = append(details, "owner")
+	}
+	return details
+}
+
+// diffFile returns what the entry changes on the existing file target: type, content, link, mode, owner
+func (e plannedEntry) diffFile(target, targetDir string, fi os.FileInfo) ([]string, error) {
+	if typeName(e.typeflag) != fileTypeName(fi) && e.typeflag != tar.TypeLink {
+		return []string{"type"}, nil
+	}
+	var details []string
+	switch e.typeflag {
+	case tar.TypeReg:
+		same, err := sameContent(e.digest, e.size, target, fi)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			details = append(details, "content")
+		}
+	case tar.TypeSymlink:
+		if link, err := os.Readlink(target); err != nil || link != e.linkname {
+			details = append(details, "link")
+		}
+	case tar.TypeLink:
+		source, err := SecureJoin(targetDir, e.linkname)
+		if err != nil {
+			return nil, err
+		}
+		if sfi, err := os.Lstat(source); err != nil || !os.SameFile(fi, sfi) {
+			details = append(details, "link")
+		}
+	}
+	if e.typeflag != tar.TypeSymlink && e.typeflag != tar.TypeLink {
+		modeBits := os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+		if fi.Mode()&modeBits != e.mode {
+			details = append(details, "mode")
+		}
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && e.typeflag != tar.TypeLink {
+		if int(st.Uid) != e.uid || int(st.Gid) != e.gid {
+			details = append(details, "owner")
+		}
+	}
+	return details, nil
+}
+
+// changeKind returns modified when some details are changed, unchanged otherwise
+func changeKind(details []string) ChangeKind {
+	if len(details) > 0 {
+		return ChangeModified
+	}
+	return ChangeUnchanged
+}
+
+// WritePlanTable writes the changes of the plan as a table per layer
+func WritePlanTable(w io.Writer, plan *Plan) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, l := range plan.Layers {
+		fmt.Fprintf(tw, "Dockerfile: %s, layer: %s\n", l.Dockerfile, l.Layer)
+		fmt.Fprintln(tw, "CHANGE\tTYPE\tPATH\tDETAILS")
+		for _, c := range l.Changes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Kind, c.Type, c.Path, strings.Join(c.Details, ","))
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintf(tw, "added: %d, modified: %d, deleted: %d, unchanged: %d, skipped: %d, failed: %d\n",
+		plan.Summary[ChangeAdded], plan.Summary[ChangeModified],
+		plan.Summary[ChangeDeleted], plan.Summary[ChangeUnchanged],
+		plan.Summary[ChangeSkipped], plan.Summary[ChangeFailed])
+	if plan.Failure != nil {
+		fmt.Fprintf(tw, "The extraction would fail on the existing %s %s as the overwrite policy is %s\n",
+			plan.Failure.Type, plan.Failure.Path, plan.Failure.Policy)
+	}
+	return tw.Flush()
+}
+
+// WritePlanJSON writes the plan as an indented JSON document to the file path
+func WritePlanJSON(path string, plan *Plan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// fileTypeName returns the same name as typeName for the type of an existing file
+func fileTypeName(fi os.FileInfo) string {
+	switch m := fi.Mode(); {
+	case m.IsDir():
+		return typeName(tar.TypeDir)
+	case m&os.ModeSymlink != 0:
+		return typeName(tar.TypeSymlink)
+	case m&os.ModeNamedPipe != 0:
+		return typeName(tar.TypeFifo)
+	case m&os.ModeCharDevice != 0:
+		return typeName(tar.TypeChar)
+	case m&os.ModeDevice != 0:
+		return typeName(tar.TypeBlock)
+	default:
+		return typeName(tar.TypeReg)
+	}
+}
+
+// sameContent compares the size then the sha256 digest of the content of a tar entry with the existing file
+func sameContent(digest []byte, size int64, target string, fi os.FileInfo) (bool, error) {
+	if fi.Size() != size {
+		return false, nil
+	}
+	f, err := os.Open(target)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	fileHash := sha256.New()
+	if _, err := io.Copy(fileHash, f); err != nil {
+		return false, err
+	}
+	return bytes.Equal(digest, fileHash.Sum(nil)), nil
+}
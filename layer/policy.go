@@ -0,0 +1,27 @@
+package layer
+
+import "fmt"
+
+// OverwritePolicy defines what to do when an entry of a layer already exists under the target dir
+type OverwritePolicy string
+
+const (
+	// OverwritePolicyOverwrite replaces the existing path with the entry of the layer
+	OverwritePolicyOverwrite OverwritePolicy = "overwrite"
+	// OverwritePolicySkip keeps the existing path and ignores the entry of the layer
+	OverwritePolicySkip OverwritePolicy = "skip"
+	// OverwritePolicyFail stops the extraction
+	OverwritePolicyFail OverwritePolicy = "fail"
+	// OverwritePolicyBackup moves the existing path to the backup dir and replaces it with the entry of the layer
+	OverwritePolicyBackup OverwritePolicy = "backup"
+)
+
+// ParseOverwritePolicy converts a string to an OverwritePolicy and returns an error if the policy is not supported
+func ParseOverwritePolicy(s string) (OverwritePolicy, error) {
+	switch p := OverwritePolicy(s); p {
+	case OverwritePolicyOverwrite, OverwritePolicySkip, OverwritePolicyFail, OverwritePolicyBackup:
+		return p, nil
+	default:
+		return "", fmt.Errorf("not a valid overwrite policy: %q. Please specify one of (overwrite, skip, fail, backup)", s)
+	}
+}
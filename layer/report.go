@@ -0,0 +1,65 @@
+package layer
+
+import "github.com/sirupsen/logrus"
+
+// Report collects what has been changed on the target dir while applying the layer(s)
+type Report struct {
+	Removed   []string      // Paths deleted due to a whiteout or an opaque whiteout marker
+	Failed    []FailedEntry // Entries of the layer which could not be created
+	Conflicts []Conflict    // Entries of the layer which already existed under the target dir
+	Changes   []Change      // Changes planned when the layer is applied in dry-run mode
+}
+
+// Fail records that the entry path of the given type could not be created
+func (r *Report) Fail(path, kind string, err error) {
+	r.Failed = append(r.Failed, FailedEntry{
+		Path:   path,
+		Type:   kind,
+		Reason: err.Error(),
+	})
+}
+
+// Merge appends the content of the report o to the report
+func (r *Report) Merge(o Report) {
+	r.Removed = append(r.Removed, o.Removed...)
+	r.Failed = append(r.Failed, o.Failed...)
+	r.Conflicts = append(r.Conflicts, o.Conflicts...)
+	r.Changes = append(r.Changes, o.Changes...)
+}
+
+// Log logs the paths removed by the whiteouts, the entries which could not be created and the conflicts
+func (r Report) Log() {
+	for _, p := range r.Removed {
+		logrus.Infof("Path removed by whiteout: %s", p)
+	}
+	logrus.Infof("%d path(s) removed by whiteout", len(r.Removed))
+	for _, f := range r.Failed {
+		logrus.Warnf("Entry not extracted: %s (%s): %s", f.Path, f.Type, f.Reason)
+	}
+	for _, c := range r.Conflicts {
+		logrus.Infof("Conflict: %s", c)
+	}
+	logrus.Infof("%d conflict(s) with existing paths", len(r.Conflicts))
+}
+
+// FailedEntry is a tar entry which could not be created on the target dir
+type FailedEntry struct {
+	Path   string
+	Type   string
+	Reason string
+}
+
+// Conflict is a tar entry which already existed under the target dir and how it has been handled
+type Conflict struct {
+	Path   string
+	Type   string
+	Policy OverwritePolicy
+	Backup string // Path of the backup when the policy is backup
+}
+
+func (c Conflict) String() string {
+	if c.Backup != "" {
+		return c.Path + " (" + c.Type + "): " + string(c.Policy) + " to " + c.Backup
+	}
+	return c.Path + " (" + c.Type + "): " + string(c.Policy)
+}
@@ -0,0 +1,70 @@
+package layer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinks is the number of symbolic links which can be followed to resolve a path. Same limit as the linux kernel
+const maxSymlinks = 255
+
+// SecureJoin joins the name of a tar entry to the root dir and resolves the symbolic links of its parent dirs as if
+// root was the `/` dir (same behavior as openat2 with RESOLVE_IN_ROOT): an absolute link is resolved from root.
+// A `..` going above root, either part of the name or of a symbolic link, is rejected with ErrPathEscapesRoot.
+// The last element of the name is not resolved as it corresponds to the entry to be created.
+func SecureJoin(root, name string) (string, error) {
+	root = filepath.Clean(root)
+	pending := strings.Split(filepath.ToSlash(name), "/")
+	resolved := ""
+	links := 0
+
+	for len(pending) > 0 {
+		elem := pending[0]
+		pending = pending[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "" {
+				return "", fmt.Errorf("%q resolved under %s: %w", name, root, ErrPathEscapesRoot)
+			}
+			resolved = filepath.Dir(resolved)
+			if resolved == "." {
+				resolved = ""
+			}
+			continue
+		}
+
+		candidate := filepath.Join(resolved, elem)
+		if len(pending) == 0 {
+			resolved = candidate
+			break
+		}
+
+		fi, err := os.Lstat(filepath.Join(root, candidate))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = candidate
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("%q resolved under %s: too many levels of symbolic links", name, root)
+		}
+		link, err := os.Readlink(filepath.Join(root, candidate))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(link) {
+			resolved = ""
+		}
+		pending = append(strings.Split(filepath.ToSlash(link), "/"), pending...)
+	}
+	return filepath.Join(root, resolved), nil
+}
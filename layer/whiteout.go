@@ -0,0 +1,100 @@
+package layer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// whiteoutPrefix prefixes the name of a file or dir deleted by a layer. See OCI image spec - layer.md#whiteouts
+	whiteoutPrefix = ".wh."
+	// whiteoutMetaPrefix prefixes the names reserved for the metadata of the whiteouts, e.g. the opaque marker
+	whiteoutMetaPrefix = whiteoutPrefix + whiteoutPrefix
+	// whiteoutOpaqueDir is the marker indicating that the content of the parent dir coming from the lower layers is hidden
+	whiteoutOpaqueDir = whiteoutMetaPrefix + ".opq"
+)
+
+// isWhiteout returns true when the name of the tar entry is a whiteout or an opaque whiteout marker. The other
+// metadata entries are not whiteouts
+func isWhiteout(name string) bool {
+	base := filepath.Base(name)
+	return strings.HasPrefix(base, whiteoutPrefix) && (base == whiteoutOpaqueDir || !strings.HasPrefix(base, whiteoutMetaPrefix))
+}
+
+// isWhiteoutMeta returns true when the tar entry is, or is under, a whiteout metadata entry other than the opaque
+// marker, e.g. the hard links dir .wh..wh.plnk of aufs. Such entries are neither extracted nor applied
+func isWhiteoutMeta(name string) bool {
+	for _, elem := range strings.Split(filepath.Clean(name), string(filepath.Separator)) {
+		if strings.HasPrefix(elem, whiteoutMetaPrefix) && elem != whiteoutOpaqueDir {
+			return true
+		}
+	}
+	return false
+}
+
+// isOpaqueWhiteout returns true when the name of the tar entry is an opaque whiteout marker
+func isOpaqueWhiteout(name string) bool {
+	return filepath.Base(name) == whiteoutOpaqueDir
+}
+
+// whiteoutPath returns the path of the file or dir hidden by the whiteout `target` (e.g. /var/lib/.wh.foo hides /var/lib/foo)
+func whiteoutPath(target string) string {
+	return filepath.Join(filepath.Dir(target), strings.TrimPrefix(filepath.Base(target), whiteoutPrefix))
+}
+
+// removeWhiteout deletes, using the function remove, the file or dir hidden by the whiteout `target`.
+// It returns the path removed or an empty string if the path did not exist
+func removeWhiteout(target string, remove func(string) error) (string, error) {
+	hidden := whiteoutPath(target)
+	if _, err := os.Lstat(hidden); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if err := remove(hidden); err != nil {
+		return "", err
+	}
+	return hidden, nil
+}
+
+// opaqueDirContent returns the content of the dir which contains the opaque marker `target`, except the paths
+// which have been extracted from the layer currently processed. A dir is returned without its content
+func opaqueDirContent(target string, extracted map[string]bool) ([]string, error) {
+	var hidden []string
+	dir := filepath.Dir(target)
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		return hidden, nil
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir || extracted[path] {
+			return nil
+		}
+		hidden = append(hidden, path)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return hidden, err
+}
+
+// removeOpaqueDirContent deletes, using the function remove, the content of the dir which contains the opaque marker
+// `target`, except the paths which have been extracted from the layer currently processed. It returns the paths removed
+func removeOpaqueDirContent(target string, extracted map[string]bool, remove func(string) error) ([]string, error) {
+	hidden, err := opaqueDirContent(target, extracted)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range hidden {
+		if err := remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return hidden, nil
+}
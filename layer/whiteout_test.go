@@ -0,0 +1,34 @@
+package layer
+
+import "testing"
+
+func TestWhiteoutNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		whiteout bool
+		opaque   bool
+		meta     bool
+	}{
+		{name: "etc/passwd"},
+		{name: "etc/.wh.passwd", whiteout: true},
+		{name: "etc/.wh..wh..opq", whiteout: true, opaque: true},
+		{name: "etc/.wh..wh.aufs", meta: true},
+		{name: ".wh..wh.plnk", meta: true},
+		{name: ".wh..wh.plnk/1234.5678", meta: true},
+		{name: ".wh..wh.plnk/.wh.passwd", whiteout: true, meta: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isWhiteout(test.name); got != test.whiteout {
+				t.Errorf("isWhiteout: expected %t, got %t", test.whiteout, got)
+			}
+			if got := isOpaqueWhiteout(test.name); got != test.opaque {
+				t.Errorf("isOpaqueWhiteout: expected %t, got %t", test.opaque, got)
+			}
+			if got := isWhiteoutMeta(test.name); got != test.meta {
+				t.Errorf("isWhiteoutMeta: expected %t, got %t", test.meta, got)
+			}
+		})
+	}
+}